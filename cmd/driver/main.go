@@ -9,6 +9,7 @@ import (
 
 	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common/config"
 	"github.com/mwantia/nomad-csi-s3-plugin/pkg/driver"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/mounter"
 )
 
 func init() {
@@ -19,6 +20,8 @@ var (
 	Endpoint = flag.String("endpoint", "unix://tmp/csi.sock", "CSI Endpoint")
 	NodeID   = flag.String("nodeid", "", "Node ID")
 	Config   = flag.String("config", "", "Configuration Path")
+	State    = flag.String("state", "", "Path of the node state file, defaults to 'state.json' next to the endpoint socket")
+	Runtime  = flag.String("runtime-dir", mounter.RuntimeDir, "Directory of files only needed while volumes are staged, like key files and write buffers")
 )
 
 func main() {
@@ -37,6 +40,15 @@ func main() {
 		d.Cfg = cfg
 	}
 
+	if strings.TrimSpace(*Runtime) != "" {
+		mounter.RuntimeDir = *Runtime
+	}
+
+	d.StatePath = *State
+	if strings.TrimSpace(d.StatePath) == "" {
+		d.StatePath = driver.DefaultStatePath(*Endpoint)
+	}
+
 	ctx := context.Background()
 
 	if err = d.Run(ctx); err != nil {
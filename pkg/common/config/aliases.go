@@ -6,11 +6,14 @@ import (
 )
 
 type Alias struct {
-	Name            string `mapstructure:"name"`
-	Endpoint        string `mapstructure:"endpoint"`
-	Region          string `mapstructure:"region"`
-	AccessKeyID     string `mapstructure:"accessKeyID"`
-	SecretAccessKey string `mapstructure:"secretAccessKey"`
+	Name            string   `mapstructure:"name"`
+	Endpoint        string   `mapstructure:"endpoint"`
+	Region          string   `mapstructure:"region"`
+	AccessKeyID     string   `mapstructure:"accessKeyID"`
+	SecretAccessKey string   `mapstructure:"secretAccessKey"`
+	MountOptions    []string `mapstructure:"mountOptions"`
+	// CapacityBytes limits the total capacity of all volumes provisioned through the alias, unlimited if 0
+	CapacityBytes int64 `mapstructure:"capacityBytes"`
 }
 
 func (c *DriverConfig) GetAlias(name string) (*Alias, bool) {
@@ -44,5 +47,9 @@ func (a *Alias) Validate() error {
 		return fmt.Errorf("secretAccessKey cannot be empty")
 	}
 
+	if a.CapacityBytes < 0 {
+		return fmt.Errorf("capacityBytes cannot be negative")
+	}
+
 	return nil
 }
@@ -11,7 +11,7 @@ import (
 	"k8s.io/mount-utils"
 )
 
-func BindFSMount(ctx context.Context, source, target string) error {
+func BindFSMount(ctx context.Context, source, target string, options []string) error {
 	if _, err := exec.LookPath("bindfs"); err != nil {
 		return fmt.Errorf("bindfs not found in PATH: %w", err)
 	}
@@ -25,7 +25,7 @@ func BindFSMount(ctx context.Context, source, target string) error {
 	}
 
 	var stderr bytes.Buffer
-	cmd := exec.CommandContext(ctx, "bindfs", source, target)
+	cmd := exec.CommandContext(ctx, "bindfs", append(options, source, target)...)
 	cmd.Stderr = &stderr
 
 	if err := cmd.Run(); err != nil {
@@ -55,6 +55,23 @@ func BindFSMount(ctx context.Context, source, target string) error {
 	return nil
 }
 
+// BindMount publishes source on target with a kernel bind mount instead of bindfs.
+func BindMount(ctx context.Context, source, target string, options []string) error {
+	if _, err := os.Stat(source); err != nil {
+		return fmt.Errorf("source path error: %w", err)
+	}
+
+	if err := os.MkdirAll(target, 0o750); err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	if err := mount.New("").Mount(source, target, "", append([]string{"bind"}, options...)); err != nil {
+		return fmt.Errorf("bind mount failed: %w", err)
+	}
+
+	return nil
+}
+
 func UnmountBindFS(ctx context.Context, target string) error {
 	if err := CleanupMountPoint(target); err != nil {
 		return err
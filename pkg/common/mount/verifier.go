@@ -23,6 +23,20 @@ type ExponentialBackoff struct {
 	Multiplier      float64
 }
 
+// Interval returns the interval to wait before the given attempt, starting with 1.
+func (b *ExponentialBackoff) Interval(attempt int) time.Duration {
+	interval := b.InitialInterval
+	for i := 1; i < attempt && interval < b.MaxInterval; i++ {
+		interval = time.Duration(float64(interval) * b.Multiplier)
+	}
+
+	if interval > b.MaxInterval {
+		interval = b.MaxInterval
+	}
+
+	return interval
+}
+
 func NewMountVerifier() *MountVerifier {
 	return &MountVerifier{
 		mounter: &mount.SafeFormatAndMount{
@@ -97,20 +111,53 @@ func (mv *MountVerifier) VerifyMount(path string) (bool, error) {
 	return true, nil
 }
 
+// CheckMount returns true if path isn't mounted yet and can be used as mount point.
+// Missing paths are created and corrupted mounts (e.g. left behind by a crashed fuse process) are cleaned up.
 func CheckMount(path string) (bool, error) {
 	verifier := NewMountVerifier()
 
 	isMounted, err := verifier.VerifyMount(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			if err = os.MkdirAll(path, 0o750); err != nil {
-				return false, err
-			}
-			isMounted = true
-		} else {
+		if !mount.IsCorruptedMnt(err) {
+			return false, err
+		}
+
+		if err := CleanupMountPoint(path); err != nil {
+			return false, fmt.Errorf("failed to clean up corrupted mount %s: %w", path, err)
+		}
+		isMounted = false
+	}
+
+	if !isMounted {
+		if err := os.MkdirAll(path, 0o750); err != nil {
 			return false, err
 		}
 	}
 
-	return isMounted, nil
+	return !isMounted, nil
+}
+
+// ListMountPoints returns all mount points of the kernel mount table.
+func ListMountPoints() (map[string]bool, error) {
+	mounts, err := mount.New("").List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mount points: %w", err)
+	}
+
+	points := make(map[string]bool, len(mounts))
+	for _, m := range mounts {
+		points[m.Path] = true
+	}
+
+	return points, nil
+}
+
+// IsHealthyMount returns true if path is listed within the mount table and is still accessible.
+func IsHealthyMount(path string, mounts map[string]bool) bool {
+	if !mounts[path] {
+		return false
+	}
+
+	stat := syscall.Statfs_t{}
+	return syscall.Statfs(path, &stat) == nil
 }
@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common/config"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultBudgetInterval is the interval in which the usage of an alias is recalculated,
+// to account for volumes that have been created or deleted outside of the controller.
+const DefaultBudgetInterval = 10 * time.Minute
+
+// aliasBudget is the cached capacity used by all volumes of an alias.
+type aliasBudget struct {
+	// Capacity of all provisioned volumes
+	used int64
+	// Capacity reserved by volumes that are still being provisioned
+	reserved int64
+	// Total capacity ever added to used, which reveals the volumes provisioned while the usage is recalculated
+	added   int64
+	updated time.Time
+}
+
+func (c *ControllerServer) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+	if err := c.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_GET_CAPACITY); err != nil {
+		log.Printf("invalid get capacity req: %v", req)
+
+		return nil, err
+	}
+
+	if c.Cfg == nil {
+		return &csi.GetCapacityResponse{}, nil
+	}
+
+	// Requests for the capacity don't contain any secrets, so the alias can only be selected through the parameters
+	aliases := make([]*config.Alias, 0)
+	if name, ok := req.GetParameters()["alias"]; ok {
+		alias, ok := c.Cfg.GetAlias(name)
+		if !ok {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Alias '%s' not found", name))
+		}
+
+		aliases = append(aliases, alias)
+	} else {
+		for i := range c.Cfg.Aliases {
+			aliases = append(aliases, &c.Cfg.Aliases[i])
+		}
+	}
+
+	var available int64
+	for _, alias := range aliases {
+		// Aliases without a budget are unlimited, which can't be reported as capacity
+		if alias.CapacityBytes <= 0 {
+			continue
+		}
+
+		client, err := s3.CreateClient(c.Cfg, map[string]string{"alias": alias.Name})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize S3 client for alias %s: %s", alias.Name, err)
+		}
+
+		used, err := c.aliasUsage(ctx, client, alias.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate usage of alias %s: %w", alias.Name, err)
+		}
+
+		if remaining := alias.CapacityBytes - used; remaining > 0 {
+			available += remaining
+		}
+	}
+
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: available,
+	}, nil
+}
+
+// aliasUsage returns the total capacity of all volumes provisioned or being provisioned through the alias. As this requires
+// the metadata of all volumes to be listed, the usage is cached and only recalculated once outdated. Volumes created before
+// the alias has been recorded within their metadata can't be attributed to any alias and aren't counted.
+func (c *ControllerServer) aliasUsage(ctx context.Context, client *s3.S3Client, alias string) (int64, error) {
+	c.budget.Lock()
+	budget := c.aliasBudget(alias)
+	if time.Since(budget.updated) < DefaultBudgetInterval {
+		used := budget.used + budget.reserved
+		c.budget.Unlock()
+
+		return used, nil
+	}
+	added := budget.added
+	c.budget.Unlock()
+
+	// Listing the metadata of all volumes takes a while, so volumes are provisioned concurrently in the meantime
+	metas, err := listVolumes(ctx, client)
+	if err != nil {
+		return 0, err
+	}
+
+	var used int64
+	for _, meta := range metas {
+		if meta.Alias == alias {
+			used += meta.CapacityBytes
+		}
+	}
+
+	c.budget.Lock()
+	defer c.budget.Unlock()
+
+	// Volumes provisioned while listing may be missing from the listing, so they're added again,
+	// which rather counts them twice than not at all until the usage is recalculated
+	budget.used = used + budget.added - added
+	budget.updated = time.Now()
+
+	return budget.used + budget.reserved, nil
+}
+
+// aliasBudget returns the cached usage of the alias, which is outdated if it has just been created.
+// The caller must hold the budget mutex.
+func (c *ControllerServer) aliasBudget(alias string) *aliasBudget {
+	if c.budgets == nil {
+		c.budgets = make(map[string]*aliasBudget)
+	}
+
+	budget, ok := c.budgets[alias]
+	if !ok {
+		budget = &aliasBudget{}
+		c.budgets[alias] = budget
+	}
+
+	return budget
+}
+
+// reserveBudget reserves the requested bytes within the budget of the alias, so that concurrent requests can't exceed it
+// while a volume is being provisioned. The reservation must be either committed or cancelled afterwards.
+func (c *ControllerServer) reserveBudget(ctx context.Context, client *s3.S3Client, alias *config.Alias, requested int64) error {
+	if _, err := c.aliasUsage(ctx, client, alias.Name); err != nil {
+		return fmt.Errorf("failed to calculate usage of alias %s: %w", alias.Name, err)
+	}
+
+	c.budget.Lock()
+	defer c.budget.Unlock()
+
+	budget := c.aliasBudget(alias.Name)
+	used := budget.used + budget.reserved
+	if used+requested > alias.CapacityBytes {
+		return status.Error(codes.ResourceExhausted, fmt.Sprintf("Requested capacity of %d bytes exceeds the remaining budget of %d bytes of alias '%s'",
+			requested, alias.CapacityBytes-used, alias.Name))
+	}
+
+	budget.reserved += requested
+
+	return nil
+}
+
+// commitBudget turns a reservation into used capacity, once the volume has been recorded within its metadata.
+func (c *ControllerServer) commitBudget(alias string, reserved int64) {
+	c.budget.Lock()
+	defer c.budget.Unlock()
+
+	budget := c.aliasBudget(alias)
+	budget.reserved -= reserved
+	budget.used += reserved
+	budget.added += reserved
+}
+
+// cancelBudget releases a reservation, after the volume failed to be provisioned.
+func (c *ControllerServer) cancelBudget(alias string, reserved int64) {
+	c.budget.Lock()
+	defer c.budget.Unlock()
+
+	c.aliasBudget(alias).reserved -= reserved
+}
+
+// releaseBudget removes the capacity of a deleted volume from the cached usage of its alias.
+func (c *ControllerServer) releaseBudget(meta *s3.FSMeta) {
+	if len(meta.Alias) <= 0 {
+		return
+	}
+
+	c.budget.Lock()
+	defer c.budget.Unlock()
+
+	if budget, ok := c.budgets[meta.Alias]; ok {
+		budget.used -= meta.CapacityBytes
+	}
+}
+
+// getAlias returns the alias with the name, if it's defined in the config.
+func (c *ControllerServer) getAlias(name string) *config.Alias {
+	if c.Cfg == nil {
+		return nil
+	}
+
+	if alias, ok := c.Cfg.GetAlias(name); ok {
+		return alias
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package controller_test
+
+import (
+	"context"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common/config"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/controller"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3/s3test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Capacity", func() {
+	var (
+		ctx    context.Context
+		server *s3test.Server
+		cs     *controller.ControllerServer
+	)
+
+	createVolume := func(name, bucketName string, capacityBytes int64) error {
+		_, err := cs.CreateVolume(ctx, &csi.CreateVolumeRequest{
+			Name:          name,
+			Parameters:    map[string]string{"bucket": bucketName},
+			CapacityRange: &csi.CapacityRange{RequiredBytes: capacityBytes},
+			VolumeCapabilities: []*csi.VolumeCapability{{
+				AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+			}},
+			Secrets: map[string]string{"alias": "budget"},
+		})
+
+		return err
+	}
+
+	availableCapacity := func() int64 {
+		resp, err := cs.GetCapacity(ctx, &csi.GetCapacityRequest{})
+		Expect(err).NotTo(HaveOccurred())
+
+		return resp.GetAvailableCapacity()
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		server = s3test.NewServer("bucket")
+
+		alias := aliasOf("budget", server)
+		alias.CapacityBytes = 10
+		cs = newControllerServer(&config.DriverConfig{
+			Aliases: []config.Alias{alias},
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should count created volumes against the budget", func() {
+		Expect(createVolume("first", "bucket", 6)).To(Succeed())
+		Expect(availableCapacity()).To(Equal(int64(4)))
+
+		err := createVolume("second", "bucket", 6)
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+	})
+
+	It("should release the reservation of volumes that failed", func() {
+		// Buckets can't be created by the test server
+		Expect(createVolume("first", "missing", 6)).NotTo(Succeed())
+		Expect(availableCapacity()).To(Equal(int64(10)))
+	})
+})
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/mounter"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// contentSource is the location of the data a new volume is populated with.
+type contentSource struct {
+	BucketName string
+	Path       string
+	Exclude    []string
+	// Meta of the source volume, which may be nil if it no longer exists
+	Meta *s3.FSMeta
+}
+
+// ContentSourceID returns the id of the snapshot or volume of the content source, which is prefixed with its kind,
+// as snapshots and volumes may have the same id. Requests without a content source have an empty id.
+func ContentSourceID(source *csi.VolumeContentSource) string {
+	if snapshot := source.GetSnapshot(); snapshot != nil {
+		return "snapshot:" + snapshot.GetSnapshotId()
+	}
+
+	if volume := source.GetVolume(); volume != nil {
+		return "volume:" + volume.GetVolumeId()
+	}
+
+	return ""
+}
+
+// resolveContentSource returns the location of a volume or snapshot, which is used as content source of a new volume.
+func (c *ControllerServer) resolveContentSource(ctx context.Context, client *s3.S3Client, source *csi.VolumeContentSource) (*contentSource, error) {
+	if snapshot := source.GetSnapshot(); snapshot != nil {
+		if err := c.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT); err != nil {
+			return nil, err
+		}
+
+		volumeID, name, err := s3.SnapshotIDToVolumeName(snapshot.GetSnapshotId())
+		if err != nil {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("Source snapshot %s not found", snapshot.GetSnapshotId()))
+		}
+
+		bucketName, prefix := common.VolumeIDToBucketPrefix(volumeID)
+		meta, err := client.GetSnapshotMeta(ctx, bucketName, prefix, name)
+		if err != nil {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("Source snapshot %s not found: %v", snapshot.GetSnapshotId(), err))
+		}
+
+		// Snapshots only contain the data of a volume, so its metadata is taken from the source volume
+		fsmeta, _ := client.GetFSMeta(ctx, bucketName, prefix)
+
+		return &contentSource{
+			BucketName: meta.BucketName,
+			Path:       s3.SnapshotDataPath(meta.Prefix, meta.Name),
+			Meta:       fsmeta,
+		}, nil
+	}
+
+	if volume := source.GetVolume(); volume != nil {
+		if err := c.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CLONE_VOLUME); err != nil {
+			return nil, err
+		}
+
+		bucketName, prefix := common.VolumeIDToBucketPrefix(volume.GetVolumeId())
+		meta, err := client.GetFSMeta(ctx, bucketName, prefix)
+		if err != nil {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("Source volume %s not found: %v", volume.GetVolumeId(), err))
+		}
+
+		return &contentSource{
+			BucketName: bucketName,
+			Path:       path.Join(prefix, meta.FSPath),
+			Exclude:    volumeObjectPaths(prefix),
+			Meta:       meta,
+		}, nil
+	}
+
+	return nil, status.Error(codes.InvalidArgument, "Unsupported volume content source")
+}
+
+// ValidateContentSource checks if the data of the source can be used by a volume with the meta.
+func ValidateContentSource(source *contentSource, meta *s3.FSMeta) error {
+	// Server-side copies of objects encrypted with a customer key would require the key for both sides
+	if meta.Encryption == s3.EncryptionSSEC {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Volumes with encryption '%s' can't be created from a content source", meta.Encryption))
+	}
+
+	if source.Meta == nil {
+		return nil
+	}
+
+	if source.Meta.Encryption == s3.EncryptionSSEC {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Content source with encryption '%s' can't be copied", source.Meta.Encryption))
+	}
+
+	// Volumes of s3backer contain the blocks of a filesystem instead of files
+	if source.Meta.Mounter != meta.Mounter && (source.Meta.Mounter == mounter.S3BackerMounterType || meta.Mounter == mounter.S3BackerMounterType) {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Volume with mounter '%s' can't be created from source with mounter '%s'", meta.Mounter, source.Meta.Mounter))
+	}
+
+	if meta.CapacityBytes < source.Meta.CapacityBytes {
+		return status.Error(codes.OutOfRange, fmt.Sprintf("Requested capacity %d is smaller than the capacity %d of the source", meta.CapacityBytes, source.Meta.CapacityBytes))
+	}
+
+	if meta.Mounter == mounter.S3BackerMounterType && meta.BlockSize != source.Meta.BlockSize {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Block size '%s' differs from block size '%s' of the source", meta.BlockSize, source.Meta.BlockSize))
+	}
+
+	return nil
+}
+
+// copyContentSource copies the data of the source into the path of the new volume, which may be located in another bucket.
+func copyContentSource(ctx context.Context, client *s3.S3Client, source *contentSource, bucketName, dst string) error {
+	exclude := source.Exclude
+	// Prevents copying the new volume into itself, if it's located within the source
+	if source.BucketName == bucketName {
+		exclude = append(exclude, dst+"/")
+	}
+
+	if _, err := client.CopyObjects(ctx, source.BucketName, source.Path, bucketName, dst, exclude...); err != nil {
+		return fmt.Errorf("failed to copy content source %s/%s: %w", source.BucketName, source.Path, err)
+	}
+
+	return nil
+}
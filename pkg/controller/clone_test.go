@@ -0,0 +1,103 @@
+package controller_test
+
+import (
+	"context"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common/config"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/controller"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3/s3test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func volumeSource(volumeID string) *csi.VolumeContentSource {
+	return &csi.VolumeContentSource{
+		Type: &csi.VolumeContentSource_Volume{
+			Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: volumeID},
+		},
+	}
+}
+
+func snapshotSource(snapshotID string) *csi.VolumeContentSource {
+	return &csi.VolumeContentSource{
+		Type: &csi.VolumeContentSource_Snapshot{
+			Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: snapshotID},
+		},
+	}
+}
+
+var _ = Describe("Clone", func() {
+	DescribeTable("ContentSourceID",
+		func(source *csi.VolumeContentSource, id string) {
+			Expect(controller.ContentSourceID(source)).To(Equal(id))
+		},
+		Entry("without content source", nil, ""),
+		Entry("volume", volumeSource("bucket/vol"), "volume:bucket/vol"),
+		Entry("snapshot", snapshotSource("bucket/vol@snap"), "snapshot:bucket/vol@snap"),
+	)
+
+	Describe("CreateVolume", func() {
+		var (
+			ctx    context.Context
+			server *s3test.Server
+			cs     *controller.ControllerServer
+		)
+
+		createRequest := func(source *csi.VolumeContentSource) *csi.CreateVolumeRequest {
+			return &csi.CreateVolumeRequest{
+				Name:       "vol",
+				Parameters: map[string]string{"bucket": "bucket"},
+				VolumeCapabilities: []*csi.VolumeCapability{{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+					AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+				}},
+				VolumeContentSource: source,
+				Secrets:             map[string]string{"alias": "first"},
+			}
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			server = s3test.NewServer()
+			putVolume(server, &s3.FSMeta{BucketName: "source", FSPath: "fs"})
+			putVolume(server, &s3.FSMeta{BucketName: "other", FSPath: "fs"})
+
+			cs = newControllerServer(&config.DriverConfig{
+				Aliases: []config.Alias{aliasOf("first", server)},
+			})
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should not copy the content source into existing volumes again", func() {
+			server.Put("source", "fs/file", "content")
+			putVolume(server, &s3.FSMeta{BucketName: "bucket", Prefix: "vol", FSPath: "fs", ContentSource: "volume:source", ContentCopied: true})
+
+			resp, err := cs.CreateVolume(ctx, createRequest(volumeSource("source")))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetVolume().GetVolumeId()).To(Equal("bucket/vol"))
+
+			_, copied := server.Get("bucket", "vol/fs/file")
+			Expect(copied).To(BeFalse())
+		})
+
+		DescribeTable("should reject existing volumes with another content source",
+			func(existing string, source *csi.VolumeContentSource) {
+				putVolume(server, &s3.FSMeta{BucketName: "bucket", Prefix: "vol", FSPath: "fs", ContentSource: existing, ContentCopied: existing != ""})
+
+				_, err := cs.CreateVolume(ctx, createRequest(source))
+				Expect(status.Code(err)).To(Equal(codes.AlreadyExists))
+			},
+			Entry("volume without content source", "", volumeSource("source")),
+			Entry("volume of another source", "volume:other", volumeSource("source")),
+			Entry("request without content source", "volume:source", nil),
+		)
+	})
+})
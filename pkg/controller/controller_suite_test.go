@@ -0,0 +1,13 @@
+package controller
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestController(tst *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(tst, "Controller")
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/minio/minio-go/v7"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// volumeHealth is the result of checking a volume through a single alias,
+// where a higher rank means that the volume has been found more precisely.
+// Missing is only set if the alias confirms that neither the bucket nor the metadata of the volume exist.
+type volumeHealth struct {
+	Rank      int
+	Missing   bool
+	Meta      *s3.FSMeta
+	Condition *csi.VolumeCondition
+}
+
+func (c *ControllerServer) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+	if len(req.GetVolumeId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "VolumeID missing in request")
+	}
+
+	if err := c.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_GET_VOLUME); err != nil {
+		log.Printf("invalid get volume req: %v", req)
+
+		return nil, err
+	}
+
+	// Requests to get a volume don't contain any secrets, so the volume is checked through every alias
+	var health *volumeHealth
+	missing := false
+	if c.Cfg != nil {
+		missing = len(c.Cfg.Aliases) > 0
+		for _, alias := range c.Cfg.Aliases {
+			h := c.checkVolume(ctx, alias.Name, req.GetVolumeId())
+			if health == nil || h.Rank > health.Rank {
+				health = h
+			}
+
+			missing = missing && h.Missing
+
+			if h.Meta != nil && !h.Condition.Abnormal {
+				break
+			}
+		}
+	}
+
+	// Volumes that are unreachable through an alias may still exist, so only volumes missing on every alias aren't found
+	if missing {
+		return nil, status.Errorf(codes.NotFound, "Volume %s not found: %s", req.GetVolumeId(), health.Condition.GetMessage())
+	}
+
+	if health == nil {
+		health = &volumeHealth{
+			Condition: &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  "No alias is configured to check the volume",
+			},
+		}
+	}
+
+	volume := &csi.Volume{
+		VolumeId: req.GetVolumeId(),
+	}
+	if health.Meta != nil {
+		volume = VolumeFromMeta(health.Meta)
+	}
+
+	return &csi.ControllerGetVolumeResponse{
+		Volume: volume,
+		// The plugin doesn't support the PUBLISH_UNPUBLISH_VOLUME capability, so the controller doesn't know which nodes
+		// the volume is published to. The spec only requires published nodes with that capability, so none are reported.
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			PublishedNodeIds: nil,
+			VolumeCondition:  health.Condition,
+		},
+	}, nil
+}
+
+// checkVolume checks if the bucket of the volume is reachable through the alias and if its metadata belongs to the volume.
+func (c *ControllerServer) checkVolume(ctx context.Context, alias, volumeID string) *volumeHealth {
+	abnormal := func(rank int, format string, args ...interface{}) *volumeHealth {
+		return &volumeHealth{
+			Rank: rank,
+			Condition: &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  fmt.Sprintf(format, args...),
+			},
+		}
+	}
+
+	bucketName, prefix := common.VolumeIDToBucketPrefix(volumeID)
+
+	client, err := s3.CreateClient(c.Cfg, map[string]string{"alias": alias})
+	if err != nil {
+		return abnormal(0, "Failed to initialize S3 client for alias '%s': %v", alias, err)
+	}
+
+	exists, err := client.BucketExists(ctx, bucketName)
+	if err != nil {
+		return abnormal(0, "Bucket %s is unreachable through alias '%s': %v", bucketName, alias, err)
+	}
+
+	if !exists {
+		health := abnormal(1, "Bucket %s doesn't exist", bucketName)
+		health.Missing = true
+
+		return health
+	}
+
+	meta, err := client.GetFSMeta(ctx, bucketName, prefix)
+	if err != nil {
+		health := abnormal(2, "Metadata %s of volume is missing or invalid: %v", path.Join(bucketName, prefix, s3.MetadataName), err)
+		health.Missing = minio.ToErrorResponse(err).Code == "NoSuchKey"
+
+		return health
+	}
+
+	if id := path.Join(meta.BucketName, meta.Prefix); id != volumeID {
+		return abnormal(3, "Metadata of volume belongs to volume %s", id)
+	}
+
+	health := &volumeHealth{
+		Rank: 4,
+		Meta: meta,
+		Condition: &csi.VolumeCondition{
+			Abnormal: false,
+			Message:  "Volume is healthy",
+		},
+	}
+
+	// The volume has been provisioned through another alias, which is required to mount it
+	if len(meta.Alias) > 0 && c.getAlias(meta.Alias) == nil {
+		health.Condition = &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Alias '%s' of volume isn't configured anymore", meta.Alias),
+		}
+	}
+
+	return health
+}
@@ -0,0 +1,74 @@
+package controller_test
+
+import (
+	"context"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common/config"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/controller"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3/s3test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("ControllerGetVolume", func() {
+	var (
+		ctx    context.Context
+		server *s3test.Server
+		cs     *controller.ControllerServer
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		server = s3test.NewServer("empty")
+		putVolume(server, &s3.FSMeta{BucketName: "bucket", Prefix: "vol", FSPath: "fs"})
+
+		cs = newControllerServer(&config.DriverConfig{
+			Aliases: []config.Alias{aliasOf("first", server), aliasOf("second", server)},
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should report existing volumes as healthy", func() {
+		resp, err := cs.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: "bucket/vol"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.GetVolume().GetVolumeId()).To(Equal("bucket/vol"))
+		Expect(resp.GetStatus().GetVolumeCondition().GetAbnormal()).To(BeFalse())
+	})
+
+	It("should fail for volumes without bucket", func() {
+		_, err := cs.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: "missing/vol"})
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+
+	It("should fail for volumes without metadata", func() {
+		_, err := cs.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: "empty/vol"})
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+
+	It("should report volumes with invalid metadata as abnormal", func() {
+		server.Put("bucket", "other/"+s3.MetadataName, "{")
+
+		resp, err := cs.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: "bucket/other"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.GetStatus().GetVolumeCondition().GetAbnormal()).To(BeTrue())
+	})
+
+	It("should report missing volumes as abnormal if an alias is unreachable", func() {
+		unreachable := aliasOf("unreachable", server)
+		unreachable.Endpoint = "http://127.0.0.1:1"
+		cs = newControllerServer(&config.DriverConfig{
+			Aliases: []config.Alias{aliasOf("first", server), unreachable},
+		})
+
+		resp, err := cs.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: "missing/vol"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.GetStatus().GetVolumeCondition().GetAbnormal()).To(BeTrue())
+	})
+})
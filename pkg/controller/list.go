@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (c *ControllerServer) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+	if err := c.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_LIST_VOLUMES); err != nil {
+		log.Printf("invalid list volumes req: %v", req)
+
+		return nil, err
+	}
+
+	start := 0
+	if token := req.GetStartingToken(); len(token) > 0 {
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 {
+			return nil, status.Error(codes.Aborted, fmt.Sprintf("Invalid starting token '%s'", token))
+		}
+		start = i
+	}
+
+	// Requests to list volumes don't contain any secrets, so only volumes reachable through an alias can be found
+	volumes := make([]*csi.Volume, 0)
+	if c.Cfg != nil && len(c.Cfg.Aliases) > 0 {
+		clients, err := c.clients(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		found := make(map[string]bool)
+		for _, client := range clients {
+			metas, err := listVolumes(ctx, client)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list volumes: %w", err)
+			}
+
+			for _, meta := range metas {
+				volume := VolumeFromMeta(meta)
+				// Multiple aliases may use the same endpoint
+				if found[volume.VolumeId] {
+					continue
+				}
+
+				found[volume.VolumeId] = true
+				volumes = append(volumes, volume)
+			}
+		}
+	}
+
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].VolumeId < volumes[j].VolumeId
+	})
+
+	if start > len(volumes) {
+		return nil, status.Error(codes.Aborted, fmt.Sprintf("Starting token %d exceeds the number of volumes", start))
+	}
+
+	end := len(volumes)
+	if max := int(req.GetMaxEntries()); max > 0 && start+max < end {
+		end = start + max
+	}
+
+	entries := make([]*csi.ListVolumesResponse_Entry, 0, end-start)
+	for _, volume := range volumes[start:end] {
+		entries = append(entries, &csi.ListVolumesResponse_Entry{
+			Volume: volume,
+		})
+	}
+
+	next := ""
+	if end < len(volumes) {
+		next = strconv.Itoa(end)
+	}
+
+	return &csi.ListVolumesResponse{
+		Entries:   entries,
+		NextToken: next,
+	}, nil
+}
+
+// listVolumes returns the metadata of all volumes within the buckets available to the client.
+func listVolumes(ctx context.Context, client *s3.S3Client) ([]*s3.FSMeta, error) {
+	buckets, err := client.Minio.ListBuckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := make([]*s3.FSMeta, 0)
+	for _, bucket := range buckets {
+		metas, err := client.ListFSMetas(ctx, bucket.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		volumes = append(volumes, metas...)
+	}
+
+	return volumes, nil
+}
+
+func VolumeFromMeta(meta *s3.FSMeta) *csi.Volume {
+	return &csi.Volume{
+		VolumeId:      path.Join(meta.BucketName, meta.Prefix),
+		CapacityBytes: meta.CapacityBytes,
+		VolumeContext: VolumeContextFromMeta(meta),
+	}
+}
+
+// VolumeContextFromMeta returns the parameters a volume has been created with.
+func VolumeContextFromMeta(meta *s3.FSMeta) map[string]string {
+	params := make(map[string]string)
+
+	set := func(key, value string) {
+		if len(value) > 0 {
+			params[key] = value
+		}
+	}
+
+	if meta.UsePrefix {
+		params["usePrefix"] = "true"
+		set("prefix", meta.Prefix)
+	}
+
+	// Volumes with a prefix are created within an existing bucket
+	if meta.UsePrefix || len(meta.Prefix) > 0 {
+		params["bucket"] = meta.BucketName
+	}
+
+	set("mounter", meta.Mounter)
+	set("vfsCacheMode", meta.VfsCacheMode)
+	set("blockSize", meta.BlockSize)
+	set("mountOptions", strings.Join(meta.MountOptions, ","))
+	set("uid", meta.UID)
+	set("gid", meta.GID)
+	set("fileMode", meta.FileMode)
+	set("dirMode", meta.DirMode)
+	set("userMap", meta.UserMap)
+	set("quota", meta.Quota)
+	set("versioning", meta.Versioning)
+	set("encryption", meta.Encryption)
+	set("kmsKeyID", meta.KMSKeyID)
+	set("clientEncryption", meta.ClientEncryption)
+
+	if meta.ScopedCredentials {
+		params["scopedCredentials"] = "true"
+	}
+
+	if meta.ObjectLock {
+		params["objectLock"] = "true"
+		set("retentionMode", meta.RetentionMode)
+		if meta.RetentionDays > 0 {
+			params["retentionDays"] = strconv.Itoa(meta.RetentionDays)
+		}
+	}
+
+	for key, value := range s3.TagParams(meta.Tags) {
+		params[key] = value
+	}
+
+	if meta.Lifecycle != nil {
+		for key, value := range meta.Lifecycle.Params() {
+			params[key] = value
+		}
+	}
+
+	return params
+}
@@ -0,0 +1,218 @@
+package controller_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	csicommon "github.com/kubernetes-csi/drivers/pkg/csi-common"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common/config"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/controller"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3/s3test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newControllerServer(cfg *config.DriverConfig) *controller.ControllerServer {
+	driver := csicommon.NewCSIDriver("s3.csi.test", "test", "node")
+	driver.AddControllerServiceCapabilities([]csi.ControllerServiceCapability_RPC_Type{
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+		csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+		csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+		csi.ControllerServiceCapability_RPC_GET_VOLUME,
+	})
+
+	return &controller.ControllerServer{
+		DefaultControllerServer: csicommon.NewDefaultControllerServer(driver),
+		Cfg:                     cfg,
+	}
+}
+
+func aliasOf(name string, server *s3test.Server) config.Alias {
+	return config.Alias{
+		Name:            name,
+		Endpoint:        server.URL,
+		Region:          s3test.Region,
+		AccessKeyID:     s3test.AccessKeyID,
+		SecretAccessKey: s3test.SecretAccessKey,
+	}
+}
+
+func putVolume(server *s3test.Server, meta *s3.FSMeta) {
+	b, err := json.Marshal(meta)
+	Expect(err).NotTo(HaveOccurred())
+
+	server.Put(meta.BucketName, path.Join(meta.Prefix, s3.MetadataName), string(b))
+}
+
+func volumeIDs(resp *csi.ListVolumesResponse) []string {
+	ids := make([]string, 0, len(resp.GetEntries()))
+	for _, entry := range resp.GetEntries() {
+		ids = append(ids, entry.GetVolume().GetVolumeId())
+	}
+
+	return ids
+}
+
+var _ = Describe("ListVolumes", func() {
+	var (
+		ctx    context.Context
+		server *s3test.Server
+		cs     *controller.ControllerServer
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		server = s3test.NewServer()
+		for i := 0; i < 5; i++ {
+			putVolume(server, &s3.FSMeta{
+				BucketName:    fmt.Sprintf("vol-%d", i),
+				FSPath:        "fs",
+				CapacityBytes: int64(i+1) << 20,
+			})
+		}
+
+		// Both aliases use the same endpoint, so each volume is found twice
+		cs = newControllerServer(&config.DriverConfig{
+			Aliases: []config.Alias{aliasOf("first", server), aliasOf("second", server)},
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should return all volumes once without pagination", func() {
+		resp, err := cs.ListVolumes(ctx, &csi.ListVolumesRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(volumeIDs(resp)).To(Equal([]string{"vol-0", "vol-1", "vol-2", "vol-3", "vol-4"}))
+		Expect(resp.GetNextToken()).To(BeEmpty())
+		Expect(resp.GetEntries()[2].GetVolume().GetCapacityBytes()).To(Equal(int64(3 << 20)))
+	})
+
+	It("should return no volumes without aliases", func() {
+		resp, err := newControllerServer(&config.DriverConfig{}).ListVolumes(ctx, &csi.ListVolumesRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.GetEntries()).To(BeEmpty())
+	})
+
+	It("should page through all volumes", func() {
+		ids := make([]string, 0)
+		token := ""
+		for pages := 0; pages < 3; pages++ {
+			resp, err := cs.ListVolumes(ctx, &csi.ListVolumesRequest{
+				MaxEntries:    2,
+				StartingToken: token,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(resp.GetEntries())).To(BeNumerically("<=", 2))
+
+			ids = append(ids, volumeIDs(resp)...)
+			token = resp.GetNextToken()
+		}
+
+		Expect(token).To(BeEmpty())
+		Expect(ids).To(Equal([]string{"vol-0", "vol-1", "vol-2", "vol-3", "vol-4"}))
+	})
+
+	DescribeTable("pagination bounds",
+		func(maxEntries int32, token string, ids []string, next string) {
+			resp, err := cs.ListVolumes(ctx, &csi.ListVolumesRequest{
+				MaxEntries:    maxEntries,
+				StartingToken: token,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volumeIDs(resp)).To(Equal(ids))
+			Expect(resp.GetNextToken()).To(Equal(next))
+		},
+		Entry("max entries exceeding the volumes", int32(10), "", []string{"vol-0", "vol-1", "vol-2", "vol-3", "vol-4"}, ""),
+		Entry("max entries matching the volumes", int32(5), "", []string{"vol-0", "vol-1", "vol-2", "vol-3", "vol-4"}, ""),
+		Entry("last page", int32(2), "4", []string{"vol-4"}, ""),
+		Entry("starting token at the end", int32(0), "5", []string{}, ""),
+		Entry("starting token without max entries", int32(0), "3", []string{"vol-3", "vol-4"}, ""),
+		Entry("page in between", int32(1), "1", []string{"vol-1"}, "2"),
+	)
+
+	DescribeTable("invalid starting tokens",
+		func(token string) {
+			_, err := cs.ListVolumes(ctx, &csi.ListVolumesRequest{StartingToken: token})
+			Expect(status.Code(err)).To(Equal(codes.Aborted))
+		},
+		Entry("not a number", "next"),
+		Entry("negative", "-1"),
+		Entry("beyond the volumes", "6"),
+	)
+})
+
+var _ = Describe("VolumeContextFromMeta", func() {
+	DescribeTable("should return the parameters the volume has been created with",
+		func(meta *s3.FSMeta, params map[string]string) {
+			Expect(controller.VolumeContextFromMeta(meta)).To(Equal(params))
+		},
+		Entry("bucket", &s3.FSMeta{BucketName: "bucket", FSPath: "fs"}, map[string]string{}),
+		Entry("prefix", &s3.FSMeta{BucketName: "bucket", Prefix: "vol", FSPath: "fs", Mounter: "rclone"}, map[string]string{
+			"bucket":  "bucket",
+			"mounter": "rclone",
+		}),
+		Entry("existing prefix", &s3.FSMeta{BucketName: "bucket", Prefix: "shared", UsePrefix: true}, map[string]string{
+			"bucket":    "bucket",
+			"usePrefix": "true",
+			"prefix":    "shared",
+		}),
+		Entry("mount parameters", &s3.FSMeta{
+			BucketName:   "bucket",
+			MountOptions: []string{"uid=1000", "gid=1000"},
+			UID:          "1000",
+			FileMode:     "0640",
+			Quota:        "node",
+		}, map[string]string{
+			"mountOptions": "uid=1000,gid=1000",
+			"uid":          "1000",
+			"fileMode":     "0640",
+			"quota":        "node",
+		}),
+		Entry("object lock", &s3.FSMeta{
+			BucketName:    "bucket",
+			Versioning:    s3.VersioningEnabled,
+			ObjectLock:    true,
+			RetentionMode: s3.RetentionGovernance,
+			RetentionDays: 7,
+		}, map[string]string{
+			"versioning":    s3.VersioningEnabled,
+			"objectLock":    "true",
+			"retentionMode": s3.RetentionGovernance,
+			"retentionDays": "7",
+		}),
+		Entry("retention without object lock", &s3.FSMeta{BucketName: "bucket", RetentionDays: 7}, map[string]string{}),
+		Entry("encryption and credentials", &s3.FSMeta{
+			BucketName:        "bucket",
+			Encryption:        s3.EncryptionSSEKMS,
+			KMSKeyID:          "key",
+			ClientEncryption:  "gocryptfs",
+			ScopedCredentials: true,
+		}, map[string]string{
+			"encryption":        s3.EncryptionSSEKMS,
+			"kmsKeyID":          "key",
+			"clientEncryption":  "gocryptfs",
+			"scopedCredentials": "true",
+		}),
+		Entry("tags", &s3.FSMeta{BucketName: "bucket", Tags: map[string]string{"team": "payments"}}, map[string]string{
+			"tag.team": "payments",
+		}),
+	)
+
+	It("should include the lifecycle of the volume", func() {
+		lifecycle, err := s3.ParseLifecycle(map[string]string{s3.LifecycleExpirationDays: "7"})
+		Expect(err).NotTo(HaveOccurred())
+
+		params := controller.VolumeContextFromMeta(&s3.FSMeta{BucketName: "bucket", Lifecycle: lifecycle})
+		Expect(params).To(Equal(lifecycle.Params()))
+	})
+})
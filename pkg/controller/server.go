@@ -6,11 +6,14 @@ import (
 	"log"
 	"path"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	csicommon "github.com/kubernetes-csi/drivers/pkg/csi-common"
 	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common"
 	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common/config"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/mounter"
 	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -24,6 +27,12 @@ var VolumeCapabilities = []csi.VolumeCapability_AccessMode{
 	{
 		Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 	},
+	{
+		Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+	},
+	{
+		Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+	},
 	{
 		Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
 	},
@@ -32,6 +41,12 @@ var VolumeCapabilities = []csi.VolumeCapability_AccessMode{
 type ControllerServer struct {
 	*csicommon.DefaultControllerServer
 	Cfg *config.DriverConfig
+	// Guards the cached usage of the aliases, which is only held briefly, as volumes are provisioned concurrently
+	budget sync.Mutex
+	// Cached usage of each alias with a budget, guarded by budget
+	budgets map[string]*aliasBudget
+	// Serializes updates of lifecycle configurations, which may be shared by multiple volumes of the same bucket
+	lifecycle sync.Mutex
 }
 
 func (c *ControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
@@ -47,6 +62,58 @@ func (c *ControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolu
 	params := req.GetParameters()
 	capacityBytes := int64(req.GetCapacityRange().GetRequiredBytes())
 	mounterType := params["mounter"]
+	vfsCacheMode := params["vfsCacheMode"]
+	blockSize := params["blockSize"]
+	uid := params["uid"]
+	gid := params["gid"]
+	fileMode := params["fileMode"]
+	dirMode := params["dirMode"]
+	userMap := params["userMap"]
+	quota := params["quota"]
+	versioning := params["versioning"]
+	encryption := params["encryption"]
+	kmsKeyID := params["kmsKeyID"]
+	clientEncryption := params["clientEncryption"]
+
+	scopedCredentials := false
+	if scoped, ok := params["scopedCredentials"]; ok && scoped != "" {
+		var err error
+		if scopedCredentials, err = strconv.ParseBool(scoped); err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid scopedCredentials '%s': %v", scoped, err))
+		}
+	}
+
+	objectLock := false
+	if lock, ok := params["objectLock"]; ok && lock != "" {
+		var err error
+		if objectLock, err = strconv.ParseBool(lock); err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid objectLock '%s': %v", lock, err))
+		}
+	}
+
+	retentionMode := params["retentionMode"]
+	retentionDays := 0
+	if days, ok := params["retentionDays"]; ok && days != "" {
+		var err error
+		if retentionDays, err = strconv.Atoi(days); err != nil || retentionDays <= 0 {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid retentionDays '%s', must be a positive number of days", days))
+		}
+	}
+
+	lifecycle, err := s3.ParseLifecycle(params)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid lifecycle: %v", err))
+	}
+
+	tags, err := s3.ParseTags(params)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var mountOptions []string
+	if options, ok := params["mountOptions"]; ok && options != "" {
+		mountOptions = mounter.NewMountOptions(options).Strings()
+	}
 
 	bucketName := volumeID
 	prefix := ""
@@ -70,6 +137,50 @@ func (c *ControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolu
 		volumeID = path.Join(bucketName, prefix)
 	}
 
+	// Volume ids only consist of the bucket and a single prefix, which is where the metadata of volumes is searched
+	if strings.Contains(prefix, "/") {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid prefix '%s', must not contain '/'", prefix))
+	}
+
+	if !mounter.IsValidMounter(mounterType) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid mounter '%s', must be one of %v", mounterType, mounter.MounterTypes))
+	}
+
+	ok, err := HasVolumeCapabilitiesSupport(req.GetVolumeCapabilities(), mounterType)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volume capabilities are not supported by mounter '%s'", mounterType))
+	}
+
+	if mounter.GetCapabilities(mounterType).RequiresCapacity && capacityBytes <= 0 {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Mounter '%s' requires a capacity to be defined", mounterType))
+	}
+
+	// Without a mounter, the mounter of the alias is only known once the volume is staged
+	if len(mounterType) > 0 {
+		if _, err := mounter.TranslateMountOptions(mounterType, mountOptions...); err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid mountOptions: %v", err))
+		}
+	} else if err := mounter.ValidateMountOptions(mountOptions...); err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid mountOptions: %v", err))
+	}
+
+	if !mounter.IsValidVfsCacheMode(vfsCacheMode) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid vfsCacheMode '%s', must be one of %v", vfsCacheMode, mounter.VfsCacheModes))
+	}
+
+	if !mounter.IsValidClientEncryption(clientEncryption) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid clientEncryption '%s', must be one of %v", clientEncryption, mounter.ClientEncryptions))
+	}
+
+	// s3backer already provides a block device, which can be encrypted by the filesystem it is formatted with
+	if len(clientEncryption) > 0 && mounterType == mounter.S3BackerMounterType {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Client encryption isn't supported by mounter '%s'", mounterType))
+	}
+
 	if err := c.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME); err != nil {
 		log.Printf("invalid create volume req: %v", req)
 
@@ -85,6 +196,31 @@ func (c *ControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolu
 		Mounter:       mounterType,
 		CapacityBytes: capacityBytes,
 		FSPath:        defaultFsPath,
+		VfsCacheMode:  vfsCacheMode,
+		BlockSize:     blockSize,
+		MountOptions:  mountOptions,
+		UID:           uid,
+		GID:           gid,
+		FileMode:      fileMode,
+		DirMode:       dirMode,
+		UserMap:       userMap,
+		Quota:         quota,
+
+		ScopedCredentials: scopedCredentials,
+		Versioning:        versioning,
+		Lifecycle:         lifecycle,
+		ObjectLock:        objectLock,
+		RetentionMode:     retentionMode,
+		RetentionDays:     retentionDays,
+		Encryption:        encryption,
+		KMSKeyID:          kmsKeyID,
+		ClientEncryption:  clientEncryption,
+		Tags:              tags,
+		ContentSource:     ContentSourceID(req.GetVolumeContentSource()),
+	}
+
+	if err := mounter.ValidateOwnership(meta, mounterType); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
 	client, err := s3.CreateClient(c.Cfg, req.GetSecrets())
@@ -92,11 +228,64 @@ func (c *ControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolu
 		return nil, fmt.Errorf("failed to initialize S3 client: %s", err)
 	}
 
+	var source *contentSource
+	if req.GetVolumeContentSource() != nil {
+		if source, err = c.resolveContentSource(ctx, client, req.GetVolumeContentSource()); err != nil {
+			return nil, err
+		}
+
+		// Volumes without a requested capacity inherit the capacity of their source
+		if capacityBytes == 0 && source.Meta != nil {
+			capacityBytes = source.Meta.CapacityBytes
+			meta.CapacityBytes = capacityBytes
+		}
+
+		if err := ValidateContentSource(source, meta); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ValidateQuota(meta); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateVersioning(meta); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateObjectLock(meta); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateEncryption(meta, req.GetSecrets()["encryptionKey"]); err != nil {
+		return nil, err
+	}
+
+	// Lifecycle rules would expire single blocks of the filesystem created by s3backer
+	if meta.Lifecycle != nil && meta.Mounter == mounter.S3BackerMounterType {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Lifecycle rules aren't supported by mounter '%s'", meta.Mounter))
+	}
+
+	if meta.Lifecycle != nil {
+		if err := meta.Lifecycle.Validate(meta); err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid lifecycle: %v", err))
+		}
+	}
+
+	alias := c.getAlias(req.GetSecrets()["alias"])
+	if alias != nil {
+		meta.Alias = alias.Name
+		if alias.CapacityBytes > 0 && capacityBytes <= 0 {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Alias '%s' has a capacity budget, which requires a capacity to be defined", alias.Name))
+		}
+	}
+
 	exists, err := client.BucketExists(ctx, bucketName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check if bucket %s exists: %v", volumeID, err)
 	}
 
+	provisioned := false
 	if exists {
 		// get meta, ignore errors as it could just mean meta does not exist yet
 		m, err := client.GetFSMeta(ctx, bucketName, prefix)
@@ -105,21 +294,113 @@ func (c *ControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolu
 			if capacityBytes > m.CapacityBytes {
 				return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("Volume with the same name: %s but smaller size already exist", volumeID))
 			}
+
+			// The content source would be copied into the data of the existing volume otherwise
+			if m.ContentSource != meta.ContentSource {
+				return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("Volume with the same name: %s but another content source already exist", volumeID))
+			}
+			provisioned = true
+			meta.ContentCopied = m.ContentCopied
 		}
-	} else {
-		if err = client.CreateBucket(ctx, bucketName); err != nil {
+	}
+
+	// Existing volumes are already part of the usage of the alias
+	budgeted := alias != nil && alias.CapacityBytes > 0 && !provisioned
+	if budgeted {
+		if err := c.reserveBudget(ctx, client, alias, capacityBytes); err != nil {
+			return nil, err
+		}
+
+		// The reservation is cancelled if the volume fails before it has been recorded within its metadata
+		defer func() {
+			if budgeted {
+				c.cancelBudget(alias.Name, capacityBytes)
+			}
+		}()
+	}
+
+	if !exists {
+		if err = client.CreateBucket(ctx, bucketName, meta.ObjectLock); err != nil {
 			return nil, fmt.Errorf("failed to create bucket %s: %v", bucketName, err)
 		}
 	}
 
+	if len(meta.Versioning) > 0 {
+		if err := client.SetBucketVersioning(ctx, bucketName, meta.Versioning); err != nil {
+			return nil, fmt.Errorf("failed to set versioning of bucket %s: %w", bucketName, err)
+		}
+	}
+
+	// Tags of volumes sharing a bucket are only applied to their metadata
+	if len(meta.Tags) > 0 && !meta.UsePrefix && prefix == "" {
+		if err := client.SetBucketTags(ctx, bucketName, meta.Tags); err != nil {
+			return nil, fmt.Errorf("failed to set tags of bucket %s: %w", bucketName, err)
+		}
+	}
+
+	// Volumes sharing a bucket are encrypted by their mounter instead, and customer keys are only known to the mounter
+	if len(meta.Encryption) > 0 && meta.Encryption != s3.EncryptionSSEC && !meta.UsePrefix && prefix == "" {
+		if err := client.SetBucketEncryption(ctx, meta); err != nil {
+			return nil, fmt.Errorf("failed to set encryption of bucket %s: %w", bucketName, err)
+		}
+	}
+
+	if len(meta.RetentionMode) > 0 {
+		if err := client.SetObjectLockRetention(ctx, bucketName, meta.RetentionMode, meta.RetentionDays); err != nil {
+			return nil, fmt.Errorf("failed to set retention of bucket %s: %w", bucketName, err)
+		}
+	}
+
 	if err = client.CreatePrefix(ctx, bucketName, path.Join(prefix, defaultFsPath)); err != nil && prefix != "" {
 		return nil, fmt.Errorf("failed to create prefix %s: %v", path.Join(prefix, defaultFsPath), err)
 	}
 
+	// Failed copies are repeated on retries, while completed copies are recorded within the metadata right away,
+	// so that retries after any of the following steps failed don't copy the source again
+	if source != nil && !meta.ContentCopied {
+		if err := copyContentSource(ctx, client, source, bucketName, path.Join(prefix, defaultFsPath)); err != nil {
+			return nil, err
+		}
+
+		meta.ContentCopied = true
+		if err := client.SetFSMeta(ctx, meta); err != nil {
+			return nil, fmt.Errorf("error setting bucket metadata: %w", err)
+		}
+
+		// Retries treat the volume as provisioned from now on
+		if budgeted {
+			c.commitBudget(alias.Name, capacityBytes)
+			budgeted = false
+		}
+	}
+
+	if meta.Quota == s3.QuotaBackend {
+		if err := client.SetBucketQuota(ctx, bucketName, capacityBytes); err != nil {
+			return nil, fmt.Errorf("failed to set quota of bucket %s: %w", bucketName, err)
+		}
+	}
+
+	if meta.Lifecycle != nil {
+		if err := c.setVolumeLifecycle(ctx, client, meta); err != nil {
+			return nil, fmt.Errorf("failed to set lifecycle of volume %s: %w", volumeID, err)
+		}
+	}
+
+	if meta.ScopedCredentials {
+		if _, err := client.CreateVolumeCredentials(ctx, meta, fmt.Sprintf("Scoped credentials of volume %s", volumeID)); err != nil {
+			return nil, fmt.Errorf("failed to create credentials of volume %s: %w", volumeID, err)
+		}
+	}
+
 	if err := client.SetFSMeta(ctx, meta); err != nil {
 		return nil, fmt.Errorf("error setting bucket metadata: %w", err)
 	}
 
+	if budgeted {
+		c.commitBudget(alias.Name, capacityBytes)
+		budgeted = false
+	}
+
 	log.Printf("create volume %s", volumeID)
 
 	return &csi.CreateVolumeResponse{
@@ -127,6 +408,7 @@ func (c *ControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolu
 			VolumeId:      volumeID,
 			CapacityBytes: capacityBytes,
 			VolumeContext: req.GetParameters(),
+			ContentSource: req.GetVolumeContentSource(),
 		},
 	}, nil
 }
@@ -161,11 +443,67 @@ func (c *ControllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolu
 		return &csi.DeleteVolumeResponse{}, nil
 	}
 
+	if !meta.UsePrefix {
+		// Snapshots are stored within the volume and would be removed along with it
+		snapshots, err := client.ListSnapshotMetas(ctx, bucketName, prefix, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list snapshots of volume %s: %w", req.GetVolumeId(), err)
+		}
+
+		if len(snapshots) > 0 {
+			return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("Volume %s still has %d snapshots", req.GetVolumeId(), len(snapshots)))
+		}
+	}
+
+	// Retained objects can't be removed, which would leave the volume partially deleted
+	if meta.ObjectLock {
+		retained, err := client.HasRetainedObjects(ctx, bucketName, prefix, meta.RetentionDays)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check retention of volume %s: %w", req.GetVolumeId(), err)
+		}
+
+		if retained {
+			return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("Volume %s still has objects under retention or legal hold", req.GetVolumeId()))
+		}
+	}
+
+	// Credentials are stored within the volume and have to be read before its data is removed.
+	// They are only revoked once the volume has been removed, so that a failed delete keeps the volume accessible.
+	var creds *s3.VolumeCredentials
+	if meta.ScopedCredentials {
+		if creds, err = client.FindVolumeCredentials(ctx, bucketName, prefix); err != nil {
+			return nil, fmt.Errorf("failed to read credentials of volume %s: %w", req.GetVolumeId(), err)
+		}
+	}
+
+	// Buckets of volumes are removed along with their lifecycle configuration
+	if meta.Lifecycle != nil && (meta.UsePrefix || prefix != "") {
+		c.lifecycle.Lock()
+		err := client.RemoveVolumeLifecycle(ctx, meta)
+		c.lifecycle.Unlock()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove lifecycle of volume %s: %w", req.GetVolumeId(), err)
+		}
+	}
+
 	var deleteErr error
 	if meta.UsePrefix {
 		// UsePrefix is true, we do not delete anything
 		log.Printf("Nothing to remove for %s", bucketName)
 
+		if meta.Quota == s3.QuotaBackend {
+			if err := client.SetBucketQuota(ctx, bucketName, 0); err != nil {
+				return nil, fmt.Errorf("failed to remove quota of bucket %s: %w", bucketName, err)
+			}
+		}
+
+		if meta.ScopedCredentials {
+			if err := client.RevokeVolumeCredentials(ctx, bucketName, prefix); err != nil {
+				return nil, fmt.Errorf("failed to revoke credentials of volume %s: %w", req.GetVolumeId(), err)
+			}
+		}
+
 		return &csi.DeleteVolumeResponse{}, nil
 	} else if prefix == "" {
 		// prefix is empty, we delete the whole bucket
@@ -188,9 +526,22 @@ func (c *ControllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolu
 			log.Fatalf("%v", err)
 		}
 
+		// Objects may have been locked individually, or while the volume was being deleted
+		if meta.ObjectLock {
+			return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("Volume %s can't be removed, as some of its objects are locked: %v", req.GetVolumeId(), deleteErr))
+		}
+
 		return nil, deleteErr
 	}
 
+	c.releaseBudget(meta)
+
+	if creds != nil {
+		if err := client.RemoveServiceAccount(ctx, creds); err != nil {
+			return nil, fmt.Errorf("failed to revoke credentials of volume %s: %w", req.GetVolumeId(), err)
+		}
+	}
+
 	return &csi.DeleteVolumeResponse{}, nil
 }
 
@@ -221,37 +572,129 @@ func (c *ControllerServer) ValidateVolumeCapabilities(ctx context.Context, req *
 		return nil, status.Error(codes.NotFound, fmt.Sprintf("bucket of volume with id %s does not exist", req.GetVolumeId()))
 	}
 
-	if _, err := client.GetFSMeta(ctx, bucketName, prefix); err != nil {
+	meta, err := client.GetFSMeta(ctx, bucketName, prefix)
+	if err != nil {
 		return nil, status.Error(codes.NotFound, fmt.Sprintf("fsmeta of volume with id %s does not exist", req.GetVolumeId()))
 	}
 
-	var confirmed *csi.ValidateVolumeCapabilitiesResponse_Confirmed
-	ok, err := HasVolumeCapabilitiesSupport(volcaps)
+	mounterType := mounter.GetMounterType(meta, client.Config)
+	ok, err := HasVolumeCapabilitiesSupport(volcaps, mounterType)
 	if err != nil {
 		return nil, err
 	}
 
-	if ok {
-		confirmed = &csi.ValidateVolumeCapabilitiesResponse_Confirmed{VolumeCapabilities: volcaps}
+	if !ok {
+		return &csi.ValidateVolumeCapabilitiesResponse{
+			Message: fmt.Sprintf("Volume capabilities are not supported by mounter '%s'", mounterType),
+		}, nil
 	}
 
 	return &csi.ValidateVolumeCapabilitiesResponse{
-		Confirmed: confirmed,
+		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{VolumeCapabilities: volcaps},
 	}, nil
 }
 
 func (c *ControllerServer) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
-	return &csi.ControllerExpandVolumeResponse{}, status.Error(codes.Unimplemented, fmt.Sprintf("%s is not implemented", "ControllerExpandVolume"))
+	if len(req.GetVolumeId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "VolumeID missing in request")
+	}
+
+	if req.GetCapacityRange() == nil {
+		return nil, status.Error(codes.InvalidArgument, "Capacity range missing in request")
+	}
+
+	if err := c.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_EXPAND_VOLUME); err != nil {
+		log.Printf("invalid expand volume req: %v", req)
+
+		return nil, err
+	}
+
+	capacityBytes := req.GetCapacityRange().GetRequiredBytes()
+	if limit := req.GetCapacityRange().GetLimitBytes(); limit > 0 && capacityBytes > limit {
+		return nil, status.Error(codes.OutOfRange, fmt.Sprintf("Requested capacity %d exceeds the limit %d", capacityBytes, limit))
+	}
+
+	bucketName, prefix := common.VolumeIDToBucketPrefix(req.GetVolumeId())
+
+	client, err := s3.CreateClient(c.Cfg, req.GetSecrets())
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize S3 client: %s", err)
+	}
+
+	meta, err := client.GetFSMeta(ctx, bucketName, prefix)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("Volume %s not found: %v", req.GetVolumeId(), err))
+	}
+
+	// The size of the block device of s3backer is fixed by its formatted filesystem
+	if meta.Mounter == mounter.S3BackerMounterType {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Mounter '%s' doesn't support volume expansion", meta.Mounter))
+	}
+
+	// Volumes are never shrunk, so repeated or outdated requests return the current capacity
+	if capacityBytes > meta.CapacityBytes {
+		delta := capacityBytes - meta.CapacityBytes
+		alias := c.getAlias(meta.Alias)
+		budgeted := alias != nil && alias.CapacityBytes > 0
+		if budgeted {
+			if err := c.reserveBudget(ctx, client, alias, delta); err != nil {
+				if status.Code(err) == codes.ResourceExhausted {
+					return nil, status.Error(codes.OutOfRange, status.Convert(err).Message())
+				}
+				return nil, err
+			}
+
+			defer func() {
+				if budgeted {
+					c.cancelBudget(alias.Name, delta)
+				}
+			}()
+		}
+
+		log.Printf("Expanding volume %s from %d to %d bytes", req.GetVolumeId(), meta.CapacityBytes, capacityBytes)
+
+		if meta.Quota == s3.QuotaBackend {
+			if err := client.SetBucketQuota(ctx, bucketName, capacityBytes); err != nil {
+				return nil, fmt.Errorf("failed to set quota of bucket %s: %w", bucketName, err)
+			}
+		}
+
+		meta.CapacityBytes = capacityBytes
+		if err := client.SetFSMeta(ctx, meta); err != nil {
+			return nil, fmt.Errorf("error setting bucket metadata: %w", err)
+		}
+
+		if budgeted {
+			c.commitBudget(alias.Name, delta)
+			budgeted = false
+		}
+	}
+
+	return &csi.ControllerExpandVolumeResponse{
+		CapacityBytes:         meta.CapacityBytes,
+		NodeExpansionRequired: true,
+	}, nil
+}
+
+func (c *ControllerServer) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
+	return &csi.ControllerModifyVolumeResponse{}, status.Error(codes.Unimplemented, fmt.Sprintf("%s is not implemented", "ControllerModifyVolume"))
+}
+
+func (c *ControllerServer) setVolumeLifecycle(ctx context.Context, client *s3.S3Client, meta *s3.FSMeta) error {
+	c.lifecycle.Lock()
+	defer c.lifecycle.Unlock()
+
+	return client.SetVolumeLifecycle(ctx, meta)
 }
 
-func HasVolumeCapabilitiesSupport(volcaps []*csi.VolumeCapability) (bool, error) {
+// HasVolumeCapabilitiesSupport returns true if every capability is supported by the driver
+// as well as by the mounter type, which may restrict the available access modes.
+func HasVolumeCapabilitiesSupport(volcaps []*csi.VolumeCapability, mounterType string) (bool, error) {
+	caps := mounter.GetCapabilities(mounterType)
+
 	supports := func(cap *csi.VolumeCapability) bool {
-		switch cap.GetAccessType().(type) {
-		case *csi.VolumeCapability_Mount:
-			break
-		case *csi.VolumeCapability_Block:
-			return false
-		default:
+		// Also checks the access type, as block volumes are only supported by some mounters
+		if !caps.Supports(cap) {
 			return false
 		}
 
@@ -273,3 +716,117 @@ func HasVolumeCapabilitiesSupport(volcaps []*csi.VolumeCapability) (bool, error)
 
 	return match, nil
 }
+
+// ValidateQuota checks if the capacity of the volume can be enforced with its quota mode.
+func ValidateQuota(meta *s3.FSMeta) error {
+	if !s3.IsValidQuota(meta.Quota) {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid quota '%s', must be one of %v", meta.Quota, s3.QuotaModes))
+	}
+
+	if meta.Quota == s3.QuotaNone {
+		return nil
+	}
+
+	if meta.CapacityBytes <= 0 {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Quota '%s' requires a capacity to be defined", meta.Quota))
+	}
+
+	// The capacity of s3backer is already enforced by the size of its block device
+	if meta.Mounter == mounter.S3BackerMounterType {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Quota '%s' isn't supported by mounter '%s'", meta.Quota, meta.Mounter))
+	}
+
+	// Quotas of the backend can only be applied to whole buckets
+	if meta.Quota == s3.QuotaBackend && meta.Prefix != "" {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Quota '%s' requires a volume with its own bucket", meta.Quota))
+	}
+
+	return nil
+}
+
+// ValidateVersioning checks if the versioning of the volume can be applied to its bucket.
+func ValidateVersioning(meta *s3.FSMeta) error {
+	if len(meta.Versioning) == 0 {
+		return nil
+	}
+
+	if meta.Versioning != s3.VersioningEnabled && meta.Versioning != s3.VersioningSuspended {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid versioning '%s', must be one of [%s %s]", meta.Versioning, s3.VersioningEnabled, s3.VersioningSuspended))
+	}
+
+	// Versioning applies to whole buckets, which may be shared with other volumes
+	if meta.UsePrefix || len(meta.Prefix) > 0 {
+		return status.Error(codes.InvalidArgument, "Versioning requires a volume with its own bucket")
+	}
+
+	return nil
+}
+
+// ValidateObjectLock checks if the object lock and retention of the volume can be applied to its bucket.
+func ValidateObjectLock(meta *s3.FSMeta) error {
+	if !meta.ObjectLock {
+		if len(meta.RetentionMode) > 0 || meta.RetentionDays > 0 {
+			return status.Error(codes.InvalidArgument, "Retention requires objectLock to be enabled")
+		}
+
+		return nil
+	}
+
+	// Object lock can only be enabled while creating a bucket
+	if meta.UsePrefix || len(meta.Prefix) > 0 {
+		return status.Error(codes.InvalidArgument, "Object lock requires a volume with its own bucket")
+	}
+
+	// Versioning of buckets with object lock can't be suspended
+	if meta.Versioning == s3.VersioningSuspended {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Object lock can't be combined with versioning '%s'", meta.Versioning))
+	}
+
+	if len(meta.RetentionMode) == 0 && meta.RetentionDays == 0 {
+		return nil
+	}
+
+	if meta.RetentionMode != s3.RetentionGovernance && meta.RetentionMode != s3.RetentionCompliance {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid retentionMode '%s', must be one of %v", meta.RetentionMode, s3.RetentionModes))
+	}
+
+	if meta.RetentionDays <= 0 {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Retention mode '%s' requires retentionDays to be defined", meta.RetentionMode))
+	}
+
+	return nil
+}
+
+// ValidateEncryption checks if the encryption of the volume can be applied by its mounter or the default encryption of its bucket.
+func ValidateEncryption(meta *s3.FSMeta, customerKey string) error {
+	if !s3.IsValidEncryption(meta.Encryption) {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid encryption '%s', must be one of %v", meta.Encryption, s3.EncryptionModes))
+	}
+
+	if (meta.Encryption == s3.EncryptionSSEKMS) != (len(meta.KMSKeyID) > 0) {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Parameter kmsKeyID is required by and only valid for encryption '%s'", s3.EncryptionSSEKMS))
+	}
+
+	if len(meta.Encryption) == 0 {
+		return nil
+	}
+
+	if mounter.RejectsEncryption(meta.Mounter) {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Encryption isn't supported by mounter '%s'", meta.Mounter))
+	}
+
+	if meta.Encryption == s3.EncryptionSSEC && len(customerKey) != s3.CustomerKeyLength {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Encryption '%s' requires the secret encryptionKey with a length of %d bytes", meta.Encryption, s3.CustomerKeyLength))
+	}
+
+	if mounter.SupportsEncryption(meta.Mounter, meta.Encryption) {
+		return nil
+	}
+
+	// Other mounters rely on the default encryption, which can only be set for whole buckets
+	if meta.Encryption == s3.EncryptionSSEC || meta.UsePrefix || len(meta.Prefix) > 0 {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Encryption '%s' isn't supported by mounter '%s' for volumes without their own bucket", meta.Encryption, meta.Mounter))
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package controller_test
+
+import (
+	"context"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common/config"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("CreateVolume", func() {
+	DescribeTable("should reject nested prefixes",
+		func(name string, params map[string]string) {
+			cs := newControllerServer(&config.DriverConfig{})
+
+			_, err := cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+				Name:       name,
+				Parameters: params,
+				VolumeCapabilities: []*csi.VolumeCapability{{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+					AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+				}},
+			})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		},
+		Entry("name", "team/vol", map[string]string{"bucket": "bucket"}),
+		Entry("existing prefix", "vol", map[string]string{"bucket": "bucket", "usePrefix": "true", "prefix": "team/vol"}),
+	)
+})
@@ -0,0 +1,292 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (c *ControllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+	if len(req.GetName()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Name missing in request")
+	}
+
+	if len(req.GetSourceVolumeId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "SourceVolumeID missing in request")
+	}
+
+	if err := c.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT); err != nil {
+		log.Printf("invalid create snapshot req: %v", req)
+
+		return nil, err
+	}
+
+	name := common.SanitizeVolumeID(req.GetName())
+	if !s3.IsValidSnapshotName(name) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Snapshot name %s must not contain '/' or '..'", req.GetName()))
+	}
+
+	volumeID := req.GetSourceVolumeId()
+	bucketName, prefix := common.VolumeIDToBucketPrefix(volumeID)
+
+	client, err := s3.CreateClient(c.Cfg, req.GetSecrets())
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize S3 client: %s", err)
+	}
+
+	meta, err := client.GetFSMeta(ctx, bucketName, prefix)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("Source volume %s not found: %v", volumeID, err))
+	}
+
+	// Snapshots of volumes storing their data next to the metadata would be part of the mounted data,
+	// where they count against the usage of the volume and can be modified or removed by its tasks
+	if len(meta.FSPath) <= 0 {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Snapshots aren't supported for volume %s, as it uses an existing prefix", volumeID))
+	}
+
+	if existing, err := client.GetSnapshotMeta(ctx, bucketName, prefix, name); err == nil {
+		if existing.SourceVolumeID != volumeID {
+			return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("Snapshot %s already exists for volume %s", name, existing.SourceVolumeID))
+		}
+
+		return &csi.CreateSnapshotResponse{
+			Snapshot: SnapshotFromMeta(existing),
+		}, nil
+	}
+
+	// Server-side copies of objects encrypted with a customer key would require the key for both sides
+	if meta.Encryption == s3.EncryptionSSEC {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Snapshots aren't supported for volumes with encryption '%s'", meta.Encryption))
+	}
+
+	log.Printf("Got a request to create snapshot %s of volume %s", name, volumeID)
+
+	size, err := client.CopyObjects(ctx, bucketName, path.Join(prefix, meta.FSPath), bucketName, s3.SnapshotDataPath(prefix, name),
+		volumeObjectPaths(prefix)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy volume %s: %w", volumeID, err)
+	}
+
+	snapshot := &s3.SnapshotMeta{
+		SnapshotID:     s3.SnapshotID(volumeID, name),
+		Name:           name,
+		SourceVolumeID: volumeID,
+		BucketName:     bucketName,
+		Prefix:         prefix,
+		SizeBytes:      size,
+		CreationTime:   time.Now().UTC(),
+	}
+
+	if err := client.SetSnapshotMeta(ctx, snapshot); err != nil {
+		return nil, fmt.Errorf("error setting snapshot metadata: %w", err)
+	}
+
+	log.Printf("create snapshot %s", snapshot.SnapshotID)
+
+	return &csi.CreateSnapshotResponse{
+		Snapshot: SnapshotFromMeta(snapshot),
+	}, nil
+}
+
+func (c *ControllerServer) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
+	if len(req.GetSnapshotId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "SnapshotID missing in request")
+	}
+
+	if err := c.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT); err != nil {
+		log.Printf("invalid delete snapshot req: %v", req)
+
+		return nil, err
+	}
+
+	volumeID, name, err := s3.SnapshotIDToVolumeName(req.GetSnapshotId())
+	if err != nil {
+		log.Printf("Snapshot %s does not exist, ignoring delete request", req.GetSnapshotId())
+
+		return &csi.DeleteSnapshotResponse{}, nil
+	}
+
+	bucketName, prefix := common.VolumeIDToBucketPrefix(volumeID)
+
+	client, err := s3.CreateClient(c.Cfg, req.GetSecrets())
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize S3 client: %s", err)
+	}
+
+	snapshot, err := client.GetSnapshotMeta(ctx, bucketName, prefix, name)
+	if err != nil {
+		log.Printf("Snapshot %s does not exist, ignoring delete request", req.GetSnapshotId())
+
+		return &csi.DeleteSnapshotResponse{}, nil
+	}
+
+	if err := client.RemoveSnapshot(ctx, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to remove snapshot %s: %w", req.GetSnapshotId(), err)
+	}
+
+	log.Printf("Snapshot %s removed", req.GetSnapshotId())
+
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+func (c *ControllerServer) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
+	if err := c.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS); err != nil {
+		log.Printf("invalid list snapshots req: %v", req)
+
+		return nil, err
+	}
+
+	start := 0
+	if token := req.GetStartingToken(); len(token) > 0 {
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 {
+			return nil, status.Error(codes.Aborted, fmt.Sprintf("Invalid starting token '%s'", token))
+		}
+		start = i
+	}
+
+	clients, err := c.clients(req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*s3.SnapshotMeta, 0)
+	for _, client := range clients {
+		metas, err := listSnapshots(ctx, client, req.GetSnapshotId(), req.GetSourceVolumeId())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list snapshots: %w", err)
+		}
+
+		snapshots = append(snapshots, metas...)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].SnapshotID < snapshots[j].SnapshotID
+	})
+
+	if start > len(snapshots) {
+		return nil, status.Error(codes.Aborted, fmt.Sprintf("Starting token %d exceeds the number of snapshots", start))
+	}
+
+	end := len(snapshots)
+	if max := int(req.GetMaxEntries()); max > 0 && start+max < end {
+		end = start + max
+	}
+
+	entries := make([]*csi.ListSnapshotsResponse_Entry, 0, end-start)
+	for _, snapshot := range snapshots[start:end] {
+		entries = append(entries, &csi.ListSnapshotsResponse_Entry{
+			Snapshot: SnapshotFromMeta(snapshot),
+		})
+	}
+
+	next := ""
+	if end < len(snapshots) {
+		next = strconv.Itoa(end)
+	}
+
+	return &csi.ListSnapshotsResponse{
+		Entries:   entries,
+		NextToken: next,
+	}, nil
+}
+
+// listSnapshots returns the snapshot with the id, all snapshots of the source volume or all snapshots available to the client.
+func listSnapshots(ctx context.Context, client *s3.S3Client, snapshotID, sourceVolumeID string) ([]*s3.SnapshotMeta, error) {
+	if len(snapshotID) > 0 {
+		volumeID, name, err := s3.SnapshotIDToVolumeName(snapshotID)
+		if err != nil {
+			return nil, nil
+		}
+
+		bucketName, prefix := common.VolumeIDToBucketPrefix(volumeID)
+		snapshot, err := client.GetSnapshotMeta(ctx, bucketName, prefix, name)
+		if err != nil || (len(sourceVolumeID) > 0 && snapshot.SourceVolumeID != sourceVolumeID) {
+			return nil, nil
+		}
+
+		return []*s3.SnapshotMeta{snapshot}, nil
+	}
+
+	if len(sourceVolumeID) > 0 {
+		bucketName, prefix := common.VolumeIDToBucketPrefix(sourceVolumeID)
+		if exists, err := client.BucketExists(ctx, bucketName); err != nil || !exists {
+			return nil, err
+		}
+
+		return client.ListSnapshotMetas(ctx, bucketName, prefix, false)
+	}
+
+	buckets, err := client.Minio.ListBuckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*s3.SnapshotMeta, 0)
+	for _, bucket := range buckets {
+		metas, err := client.ListSnapshotMetas(ctx, bucket.Name, "", true)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshots = append(snapshots, metas...)
+	}
+
+	return snapshots, nil
+}
+
+// clients returns a client for the secrets of a request, or a client for each alias if no secrets are defined.
+func (c *ControllerServer) clients(secrets map[string]string) ([]*s3.S3Client, error) {
+	if len(secrets) > 0 || c.Cfg == nil || len(c.Cfg.Aliases) == 0 {
+		client, err := s3.CreateClient(c.Cfg, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize S3 client: %s", err)
+		}
+
+		return []*s3.S3Client{client}, nil
+	}
+
+	clients := make([]*s3.S3Client, 0, len(c.Cfg.Aliases))
+	for _, alias := range c.Cfg.Aliases {
+		client, err := s3.CreateClient(c.Cfg, map[string]string{"alias": alias.Name})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize S3 client for alias %s: %s", alias.Name, err)
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients, nil
+}
+
+// volumeObjectPaths returns the paths of all objects, which belong to the volume itself instead of its data.
+func volumeObjectPaths(prefix string) []string {
+	return []string{
+		path.Join(prefix, s3.MetadataName),
+		path.Join(prefix, s3.CredentialsName),
+		path.Join(prefix, s3.SnapshotsPath) + "/",
+		path.Join(prefix, s3.SnapshotMetaPrefix),
+	}
+}
+
+func SnapshotFromMeta(meta *s3.SnapshotMeta) *csi.Snapshot {
+	return &csi.Snapshot{
+		SnapshotId:     meta.SnapshotID,
+		SourceVolumeId: meta.SourceVolumeID,
+		SizeBytes:      meta.SizeBytes,
+		CreationTime:   timestamppb.New(meta.CreationTime),
+		ReadyToUse:     true,
+	}
+}
@@ -0,0 +1,78 @@
+package controller_test
+
+import (
+	"strings"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/controller"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/mounter"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func expectValid(err error, valid bool) {
+	if valid {
+		Expect(err).NotTo(HaveOccurred())
+		return
+	}
+
+	Expect(err).To(HaveOccurred())
+	Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+}
+
+var customerKey = strings.Repeat("k", s3.CustomerKeyLength)
+
+var _ = Describe("Validate", func() {
+	DescribeTable("ValidateVersioning",
+		func(meta *s3.FSMeta, valid bool) {
+			expectValid(controller.ValidateVersioning(meta), valid)
+		},
+		Entry("without versioning", &s3.FSMeta{BucketName: "bucket", Prefix: "vol"}, true),
+		Entry("enabled", &s3.FSMeta{BucketName: "bucket", Versioning: s3.VersioningEnabled}, true),
+		Entry("suspended", &s3.FSMeta{BucketName: "bucket", Versioning: s3.VersioningSuspended}, true),
+		Entry("unknown mode", &s3.FSMeta{BucketName: "bucket", Versioning: "always"}, false),
+		Entry("prefix", &s3.FSMeta{BucketName: "bucket", Prefix: "vol", Versioning: s3.VersioningEnabled}, false),
+		Entry("existing prefix", &s3.FSMeta{BucketName: "bucket", UsePrefix: true, Versioning: s3.VersioningEnabled}, false),
+	)
+
+	DescribeTable("ValidateObjectLock",
+		func(meta *s3.FSMeta, valid bool) {
+			expectValid(controller.ValidateObjectLock(meta), valid)
+		},
+		Entry("without object lock", &s3.FSMeta{BucketName: "bucket", Prefix: "vol"}, true),
+		Entry("retention without object lock", &s3.FSMeta{BucketName: "bucket", RetentionMode: s3.RetentionGovernance, RetentionDays: 1}, false),
+		Entry("retention days without object lock", &s3.FSMeta{BucketName: "bucket", RetentionDays: 1}, false),
+		Entry("object lock", &s3.FSMeta{BucketName: "bucket", ObjectLock: true}, true),
+		Entry("object lock with prefix", &s3.FSMeta{BucketName: "bucket", Prefix: "vol", ObjectLock: true}, false),
+		Entry("object lock with suspended versioning", &s3.FSMeta{BucketName: "bucket", ObjectLock: true, Versioning: s3.VersioningSuspended}, false),
+		Entry("object lock with enabled versioning", &s3.FSMeta{BucketName: "bucket", ObjectLock: true, Versioning: s3.VersioningEnabled}, true),
+		Entry("governance retention", &s3.FSMeta{BucketName: "bucket", ObjectLock: true, RetentionMode: s3.RetentionGovernance, RetentionDays: 7}, true),
+		Entry("compliance retention", &s3.FSMeta{BucketName: "bucket", ObjectLock: true, RetentionMode: s3.RetentionCompliance, RetentionDays: 7}, true),
+		Entry("unknown retention mode", &s3.FSMeta{BucketName: "bucket", ObjectLock: true, RetentionMode: "legal", RetentionDays: 7}, false),
+		Entry("retention days without mode", &s3.FSMeta{BucketName: "bucket", ObjectLock: true, RetentionDays: 7}, false),
+		Entry("retention mode without days", &s3.FSMeta{BucketName: "bucket", ObjectLock: true, RetentionMode: s3.RetentionGovernance}, false),
+	)
+
+	DescribeTable("ValidateEncryption",
+		func(meta *s3.FSMeta, key string, valid bool) {
+			expectValid(controller.ValidateEncryption(meta, key), valid)
+		},
+		Entry("without encryption", &s3.FSMeta{BucketName: "bucket", Prefix: "vol"}, "", true),
+		Entry("unknown mode", &s3.FSMeta{BucketName: "bucket", Encryption: "rot13"}, "", false),
+		Entry("kms key without sse-kms", &s3.FSMeta{BucketName: "bucket", Encryption: s3.EncryptionSSES3, KMSKeyID: "key"}, "", false),
+		Entry("sse-kms without kms key", &s3.FSMeta{BucketName: "bucket", Encryption: s3.EncryptionSSEKMS}, "", false),
+		Entry("sse-kms", &s3.FSMeta{BucketName: "bucket", Prefix: "vol", Encryption: s3.EncryptionSSEKMS, KMSKeyID: "key"}, "", true),
+		Entry("sse-c without customer key", &s3.FSMeta{BucketName: "bucket", Encryption: s3.EncryptionSSEC}, "", false),
+		Entry("sse-c with short customer key", &s3.FSMeta{BucketName: "bucket", Encryption: s3.EncryptionSSEC}, "short", false),
+		Entry("sse-c applied by the mounter", &s3.FSMeta{BucketName: "bucket", Prefix: "vol", Encryption: s3.EncryptionSSEC}, customerKey, true),
+		Entry("sse-c not supported by the mounter", &s3.FSMeta{BucketName: "bucket", Mounter: mounter.MountpointS3MounterType, Encryption: s3.EncryptionSSEC}, customerKey, false),
+		Entry("default encryption of own bucket", &s3.FSMeta{BucketName: "bucket", Mounter: mounter.MountpointS3MounterType, Encryption: s3.EncryptionSSES3}, "", true),
+		Entry("default encryption of shared bucket", &s3.FSMeta{BucketName: "bucket", Prefix: "vol", Mounter: mounter.MountpointS3MounterType, Encryption: s3.EncryptionSSES3}, "", false),
+		Entry("sse-s3 applied by the mounter", &s3.FSMeta{BucketName: "bucket", Prefix: "vol", Mounter: mounter.GeeseFSMounterType, Encryption: s3.EncryptionSSES3}, "", true),
+		Entry("native without encryption", &s3.FSMeta{BucketName: "bucket", Mounter: mounter.NativeMounterType}, "", true),
+		Entry("native with default encryption of own bucket", &s3.FSMeta{BucketName: "bucket", Mounter: mounter.NativeMounterType, Encryption: s3.EncryptionSSES3}, "", false),
+	)
+})
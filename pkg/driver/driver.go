@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"path/filepath"
+	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	csicommon "github.com/kubernetes-csi/drivers/pkg/csi-common"
@@ -11,13 +13,16 @@ import (
 	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common/config"
 	"github.com/mwantia/nomad-csi-s3-plugin/pkg/controller"
 	"github.com/mwantia/nomad-csi-s3-plugin/pkg/identity"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/mounter"
 	"github.com/mwantia/nomad-csi-s3-plugin/pkg/node"
 )
 
 type Driver struct {
-	Driver           *csicommon.CSIDriver
-	Cfg              *config.DriverConfig
-	Endpoint         string
+	Driver   *csicommon.CSIDriver
+	Cfg      *config.DriverConfig
+	Endpoint string
+	// Path of the file the node persists its volumes to, disabled if empty
+	StatePath        string
 	IdentityServer   *identity.IdentityServer
 	NodeServer       *node.Nodeserver
 	ControllerServer *controller.ControllerServer
@@ -57,11 +62,26 @@ func (d *Driver) NewControllerServer() *controller.ControllerServer {
 }
 
 func (d *Driver) NewNodeServer() *node.Nodeserver {
-	return &node.Nodeserver{
+	ns := &node.Nodeserver{
 		DefaultNodeServer: csicommon.NewDefaultNodeServer(d.Driver),
 		Cfg:               d.Cfg,
 		Mutexes:           common.NewKeyMutex(32),
+		Supervisor:        mounter.NewSupervisor(),
+		Usage:             node.NewUsageCache(),
 	}
+	ns.Supervisor.OnEvent = ns.RecordRestart
+
+	return ns
+}
+
+// DefaultStatePath returns the path of the state file next to the unix socket of the endpoint,
+// as the socket directory is persisted by Nomad across restarts of the plugin.
+func DefaultStatePath(endpoint string) string {
+	if !strings.HasPrefix(endpoint, "unix://") {
+		return ""
+	}
+
+	return filepath.Join(filepath.Dir(strings.TrimPrefix(endpoint, "unix://")), "state.json")
 }
 
 func (d *Driver) Run(ctx context.Context) error {
@@ -70,16 +90,35 @@ func (d *Driver) Run(ctx context.Context) error {
 
 	d.Driver.AddControllerServiceCapabilities([]csi.ControllerServiceCapability_RPC_Type{
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+		csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+		csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+		csi.ControllerServiceCapability_RPC_GET_VOLUME,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
 	})
 	d.Driver.AddVolumeCapabilityAccessModes([]csi.VolumeCapability_AccessMode_Mode{
 		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
 		csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
 	})
 
 	d.IdentityServer = d.NewIdentityServer()
 	d.NodeServer = d.NewNodeServer()
+	if len(d.StatePath) > 0 {
+		d.NodeServer.State = node.NewStateFile(d.StatePath)
+		if err := d.NodeServer.RestoreState(ctx); err != nil {
+			log.Printf("Unable to restore node state: %v", err)
+		}
+	}
 	d.ControllerServer = d.NewControllerServer()
 
+	go d.NodeServer.Supervisor.Run(ctx)
+	go d.NodeServer.EnforceQuotas(ctx)
+
 	server := csicommon.NewNonBlockingGRPCServer()
 	server.Start(d.Endpoint, d.IdentityServer, d.ControllerServer, d.NodeServer)
 	server.Wait()
@@ -6,10 +6,10 @@ import (
 	"os"
 
 	"github.com/mwantia/nomad-csi-s3-plugin/pkg/driver"
-	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
-	"github.com/kubernetes-csi/csi-test/pkg/sanity"
+	"github.com/kubernetes-csi/csi-test/v5/pkg/sanity"
 )
 
 var _ = Describe("S3Driver", func() {
@@ -30,17 +30,16 @@ var _ = Describe("S3Driver", func() {
 		go d.Run(ctx)
 
 		Describe("CSI sanity", func() {
-			sanityCfg := &sanity.Config{
-				TargetPath:  os.TempDir() + "/s3fs-target",
-				StagingPath: os.TempDir() + "/s3fs-staging",
-				Address:     endpoint,
-				SecretsFile: "../../test/secret.yaml",
-				TestVolumeParameters: map[string]string{
-					"mounter": "s3fs",
-					"bucket":  "testbucket1",
-				},
+			sanityCfg := sanity.NewTestConfig()
+			sanityCfg.TargetPath = os.TempDir() + "/s3fs-target"
+			sanityCfg.StagingPath = os.TempDir() + "/s3fs-staging"
+			sanityCfg.Address = endpoint
+			sanityCfg.SecretsFile = "../../test/secret.yaml"
+			sanityCfg.TestVolumeParameters = map[string]string{
+				"mounter": "s3fs",
+				"bucket":  "testbucket1",
 			}
-			sanity.GinkgoTest(sanityCfg)
+			sanity.GinkgoTest(&sanityCfg)
 		})
 	})
 })
@@ -0,0 +1,121 @@
+package mounter
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+)
+
+// Capabilities declares which volume capabilities a mounter is able to honour.
+type Capabilities struct {
+	AccessModes []csi.VolumeCapability_AccessMode_Mode
+	// Block is true if the mounter is able to expose volumes as block device
+	Block bool
+	// RequiresCapacity is true if volumes can only be created with a fixed capacity
+	RequiresCapacity bool
+}
+
+// DefaultCapabilities are used by every mounter without an entry in mounterCapabilities.
+var DefaultCapabilities = Capabilities{
+	AccessModes: []csi.VolumeCapability_AccessMode_Mode{
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+	},
+}
+
+var mounterCapabilities = map[string]Capabilities{
+	// mountpoint-s3 can't coordinate writes between multiple writers
+	MountpointS3MounterType: {
+		AccessModes: []csi.VolumeCapability_AccessMode_Mode{
+			csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+			csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+		},
+	},
+	// s3backer devices can only be attached to a single node at a time, unless they are read-only
+	S3BackerMounterType: {
+		AccessModes: []csi.VolumeCapability_AccessMode_Mode{
+			csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+			csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+		},
+		Block:            true,
+		RequiresCapacity: true,
+	},
+}
+
+// encryptionModes lists the encryption modes a mounter is able to apply to the objects it writes.
+// Mounters without an entry rely on the default encryption of the bucket, while mounters with an empty entry
+// don't support encryption at all.
+var encryptionModes = map[string][]string{
+	S3FSMounterType:    {s3.EncryptionSSES3, s3.EncryptionSSEKMS, s3.EncryptionSSEC},
+	RcloneMounterType:  {s3.EncryptionSSES3, s3.EncryptionSSEKMS, s3.EncryptionSSEC},
+	GeeseFSMounterType: {s3.EncryptionSSES3, s3.EncryptionSSEKMS},
+	// The native filesystem neither applies any encryption to the objects it writes nor reads objects encrypted with a customer key
+	NativeMounterType: {},
+}
+
+// SupportsEncryption returns true if the mounter is able to apply the encryption mode itself.
+func SupportsEncryption(mounter, mode string) bool {
+	// Volumes without a mounter are mounted with 's3fs'
+	if len(mounter) <= 0 {
+		mounter = S3FSMounterType
+	}
+
+	for _, m := range encryptionModes[mounter] {
+		if m == mode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RejectsEncryption returns true if the mounter doesn't support any encryption, not even the default encryption of the bucket.
+func RejectsEncryption(mounter string) bool {
+	modes, ok := encryptionModes[mounter]
+	return ok && len(modes) == 0
+}
+
+// GetCapabilities returns the capabilities declared for the mounter type.
+func GetCapabilities(mounter string) Capabilities {
+	if caps, ok := mounterCapabilities[mounter]; ok {
+		return caps
+	}
+
+	return DefaultCapabilities
+}
+
+// Supports returns true if the capability can be honoured by the mounter.
+func (c Capabilities) Supports(capability *csi.VolumeCapability) bool {
+	switch capability.GetAccessType().(type) {
+	case *csi.VolumeCapability_Mount:
+		break
+	case *csi.VolumeCapability_Block:
+		if !c.Block {
+			return false
+		}
+	default:
+		return false
+	}
+
+	for _, mode := range c.AccessModes {
+		if mode == capability.GetAccessMode().GetMode() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsReadOnly returns true if the access mode of the capability doesn't allow any writes.
+func IsReadOnly(capability *csi.VolumeCapability) bool {
+	switch capability.GetAccessMode().GetMode() {
+	case csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,86 @@
+package mounter
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	cmount "github.com/mwantia/nomad-csi-s3-plugin/pkg/common/mount"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+)
+
+type GeeseFSMounter struct {
+	Meta *s3.FSMeta
+	Cfg  *s3.S3Config
+}
+
+func NewGeeseFSMounter(meta *s3.FSMeta, cfg *s3.S3Config) (Mounter, error) {
+	return &GeeseFSMounter{
+		Meta: meta,
+		Cfg:  cfg,
+	}, nil
+}
+
+// Stage implements Mounter.
+func (g *GeeseFSMounter) Stage(ctx context.Context, stagePath string, capability *csi.VolumeCapability) error {
+	bucket := g.Meta.BucketName
+	if prefix := path.Join(g.Meta.Prefix, g.Meta.FSPath); len(prefix) > 0 {
+		bucket = fmt.Sprintf("%s:%s", bucket, prefix)
+	}
+
+	options, err := GetMountOptions([]string{
+		"file-mode=0666",
+		"dir-mode=0777",
+	}, g.Meta, g.Cfg, capability)
+	if err != nil {
+		return err
+	}
+
+	if IsReadOnly(capability) {
+		options.Set("ro")
+	}
+
+	switch g.Meta.Encryption {
+	case s3.EncryptionSSES3:
+		options.Set("sse")
+	case s3.EncryptionSSEKMS:
+		options.Set(fmt.Sprintf("sse-kms=%s", g.Meta.KMSKeyID))
+	}
+
+	args := []string{
+		fmt.Sprintf("--endpoint=%s", g.Cfg.Endpoint),
+		"-o", "allow_other",
+	}
+	if len(g.Cfg.Region) > 0 {
+		args = append(args, fmt.Sprintf("--region=%s", g.Cfg.Region))
+	}
+	// Options of fuse are only accepted through '-o', all others are flags
+	fuse := options.Extract(FuseMountOptions...)
+	args = append(args, fuse.Args("-o")...)
+	args = append(args, options.Args("--")...)
+
+	return FuseMountWithEnv(ctx, stagePath, "geesefs", append(args, bucket, stagePath), []string{
+		fmt.Sprintf("AWS_ACCESS_KEY_ID=%s", g.Cfg.AccessKeyID),
+		fmt.Sprintf("AWS_SECRET_ACCESS_KEY=%s", g.Cfg.SecretAccessKey),
+	})
+}
+
+// Unstage implements Mounter.
+func (g *GeeseFSMounter) Unstage(ctx context.Context, stagePath string) error {
+	return FuseUnstage(ctx, stagePath)
+}
+
+func (g *GeeseFSMounter) Mount(ctx context.Context, source string, target string, capability *csi.VolumeCapability, readonly bool) error {
+	options, err := BindFSOptions(g.Meta, readonly)
+	if err != nil {
+		return err
+	}
+
+	return cmount.BindFSMount(ctx, source, target, options)
+}
+
+func (g *GeeseFSMounter) Unmount(ctx context.Context, target string) error {
+	return BindUnmount(ctx, target)
+}
@@ -0,0 +1,77 @@
+package mounter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+const (
+	GocryptfsEncryption = "gocryptfs"
+	// Config stored by gocryptfs next to the encrypted files, which contains the master key encrypted with the passphrase
+	GocryptfsConfigName = "gocryptfs.conf"
+)
+
+// ClientEncryptions lists the supported layers of client-side encryption.
+var ClientEncryptions = []string{GocryptfsEncryption}
+
+// IsValidClientEncryption returns true if encryption is empty or one of ClientEncryptions.
+func IsValidClientEncryption(encryption string) bool {
+	if len(encryption) <= 0 {
+		return true
+	}
+
+	for _, e := range ClientEncryptions {
+		if e == encryption {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CryptPath returns the path the encrypted files of a volume are staged to by its mounter,
+// while the staging path itself exposes the decrypted files.
+func CryptPath(stagePath string) string {
+	return stagePath + ".crypt"
+}
+
+// GocryptfsMount mounts the decrypted view of cipherDir at target, initializing cipherDir on first use.
+// The passphrase is passed through stdin, so that it is neither visible as argument nor written to disk.
+func GocryptfsMount(ctx context.Context, cipherDir, target, passphrase string, readonly bool) error {
+	if _, err := os.Stat(path.Join(cipherDir, GocryptfsConfigName)); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to check for gocryptfs config: %w", err)
+		}
+
+		// Fails for directories that already contain files, so existing plaintext data is never encrypted in place
+		if err := gocryptfsInit(ctx, cipherDir, passphrase); err != nil {
+			return err
+		}
+	}
+
+	args := []string{"-q", "-allow_other"}
+	if readonly {
+		args = append(args, "-ro")
+	}
+
+	return fuseMount(ctx, target, "gocryptfs", append(args, cipherDir, target), nil, strings.NewReader(passphrase+"\n"))
+}
+
+func gocryptfsInit(ctx context.Context, cipherDir, passphrase string) error {
+	cmd := exec.CommandContext(ctx, "gocryptfs", "-init", "-q", cipherDir)
+	cmd.Stdin = strings.NewReader(passphrase + "\n")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to initialize gocryptfs in %s: %v - output: %s", cipherDir, err, stderr.String())
+	}
+
+	return nil
+}
@@ -1,16 +1,21 @@
 package mounter
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common"
 	cmount "github.com/mwantia/nomad-csi-s3-plugin/pkg/common/mount"
 
 	"github.com/mitchellh/go-ps"
@@ -18,22 +23,92 @@ import (
 	"k8s.io/utils/mount"
 )
 
+const (
+	S3FSMounterType         = "s3fs"
+	RcloneMounterType       = "rclone"
+	GeeseFSMounterType      = "geesefs"
+	MountpointS3MounterType = "mountpoint-s3"
+	NativeMounterType       = "native"
+	S3BackerMounterType     = "s3backer"
+)
+
+var MounterTypes = []string{S3FSMounterType, RcloneMounterType, GeeseFSMounterType, MountpointS3MounterType, NativeMounterType, S3BackerMounterType}
+
+// IsValidMounter returns true if mounter is empty or one of MounterTypes.
+func IsValidMounter(mounter string) bool {
+	if len(mounter) <= 0 {
+		return true
+	}
+
+	for _, m := range MounterTypes {
+		if m == mounter {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RuntimeDir contains files that are only needed while volumes are staged, like the key files of mounters.
+var RuntimeDir = filepath.Join(os.TempDir(), "nomad-csi-s3")
+
+// RuntimePath returns the path of a file or directory within RuntimeDir that belongs to the staging path,
+// so that it can still be removed when the volume is unstaged after a restart of the plugin.
+func RuntimePath(name, stagePath string) string {
+	return filepath.Join(RuntimeDir, fmt.Sprintf("%s-%08x", name, common.HashToUint32([]byte(stagePath))))
+}
+
+// WriteRuntimeFile writes content to the file within RuntimeDir, which is only readable by the plugin.
+func WriteRuntimeFile(file, content string) error {
+	if err := os.MkdirAll(RuntimeDir, 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, []byte(content), 0o600)
+}
+
 type Mounter interface {
-	Stage(ctx context.Context, stagePath string) error
+	Stage(ctx context.Context, stagePath string, capability *csi.VolumeCapability) error
 	Unstage(ctx context.Context, stagePath string) error
-	Mount(ctx context.Context, source string, target string) error
+	Mount(ctx context.Context, source string, target string, capability *csi.VolumeCapability, readonly bool) error
 	Unmount(ctx context.Context, target string) error
 }
 
-func NewMounter(meta *s3.FSMeta, cfg *s3.S3Config) (Mounter, error) {
+// GetMounterType returns the mounter defined for the volume, falling back to the client config.
+func GetMounterType(meta *s3.FSMeta, cfg *s3.S3Config) string {
 	mounter := meta.Mounter
 	if len(mounter) <= 0 {
 		mounter = cfg.Mounter
 	}
 
+	return mounter
+}
+
+// CapacitySetter is implemented by mounters, which report the capacity of a volume from within their filesystem,
+// so that the capacity can be updated while the volume is staged.
+type CapacitySetter interface {
+	SetCapacity(capacityBytes int64)
+}
+
+func NewMounter(meta *s3.FSMeta, cfg *s3.S3Config) (Mounter, error) {
+	mounter := GetMounterType(meta, cfg)
 	switch mounter {
-	case "s3fs":
+	case S3FSMounterType:
 		return NewS3FSMounter(meta, cfg)
+	case RcloneMounterType:
+		return NewRcloneMounter(meta, cfg)
+	case GeeseFSMounterType:
+		return NewGeeseFSMounter(meta, cfg)
+	case MountpointS3MounterType:
+		return NewMountpointS3Mounter(meta, cfg)
+	case NativeMounterType:
+		return NewNativeMounter(meta, cfg)
+	case S3BackerMounterType:
+		return NewS3BackerMounter(meta, cfg)
+	}
+
+	if len(mounter) > 0 {
+		return nil, fmt.Errorf("invalid mounter '%s', must be one of %v", mounter, MounterTypes)
 	}
 
 	// Defaults to 's3fs'
@@ -41,15 +116,30 @@ func NewMounter(meta *s3.FSMeta, cfg *s3.S3Config) (Mounter, error) {
 }
 
 func FuseMount(ctx context.Context, path, command string, args []string) error {
+	return FuseMountWithEnv(ctx, path, command, args, nil)
+}
+
+// FuseMountWithEnv behaves like FuseMount, but appends env to the environment of the
+// mount command, so that credentials don't have to be passed as arguments.
+func FuseMountWithEnv(ctx context.Context, path, command string, args []string, env []string) error {
+	return fuseMount(ctx, path, command, args, env, nil)
+}
+
+func fuseMount(ctx context.Context, path, command string, args []string, env []string, stdin io.Reader) error {
 	cmd := exec.Command(command, args...)
+	cmd.Stdin = stdin
 
 	log.Printf("Mounting fuse with command: %s and args: %s", command, args)
 
+	var stderr bytes.Buffer
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error fuseMount command: %s\nargs: %s\noutput", command, args)
+		return fmt.Errorf("error fuseMount command: %s\nargs: %s\nerror: %v\noutput: %s", command, args, err, stderr.String())
 	}
 
 	verifier := cmount.NewMountVerifier()
@@ -78,6 +168,99 @@ func FuseUnmount(ctx context.Context, path string) error {
 	return WaitForProcess(ctx, process, 1)
 }
 
+// FuseUnstage unmounts the fuse filesystem at stagePath and removes the mount point.
+func FuseUnstage(ctx context.Context, stagePath string) error {
+	if err := FuseUnmount(ctx, stagePath); err != nil {
+		return err
+	}
+
+	if err := os.Remove(stagePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// BindFSOptions returns the bindfs options used to publish a volume, including its ownership mapping.
+func BindFSOptions(meta *s3.FSMeta, readonly bool) ([]string, error) {
+	options, err := OwnershipOptions(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	if readonly {
+		options = append(options, "--read-only")
+	}
+
+	return options, nil
+}
+
+// BindOptions returns the mount options used to publish a volume with a kernel bind mount.
+func BindOptions(readonly bool) []string {
+	if readonly {
+		return []string{"ro"}
+	}
+
+	return nil
+}
+
+// statfsMountFlags maps the flags reported by statfs to their mount flags.
+var statfsMountFlags = map[int64]uintptr{
+	0x0002: syscall.MS_NOSUID,
+	0x0004: syscall.MS_NODEV,
+	0x0008: syscall.MS_NOEXEC,
+	0x0400: syscall.MS_NOATIME,
+	0x0800: syscall.MS_NODIRATIME,
+	0x1000: syscall.MS_RELATIME,
+}
+
+// Remount changes whether a published target is read-only without unmounting it.
+// Only the flags of the mount point are changed, so the same works for bind and bindfs mounts.
+func Remount(target string, readonly bool) error {
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(target, &stat); err != nil {
+		return fmt.Errorf("failed to stat mount %s: %w", target, err)
+	}
+
+	// Flags that aren't passed to the remount are cleared, so the existing restrictions are kept
+	flags := uintptr(syscall.MS_REMOUNT | syscall.MS_BIND)
+	for statfsFlag, mountFlag := range statfsMountFlags {
+		if stat.Flags&statfsFlag != 0 {
+			flags |= mountFlag
+		}
+	}
+	if readonly {
+		flags |= syscall.MS_RDONLY
+	}
+
+	if err := syscall.Mount("", target, "", flags, ""); err != nil {
+		return fmt.Errorf("failed to remount %s: %w", target, err)
+	}
+
+	return nil
+}
+
+// BindUnmount removes a target previously published with cmount.BindFSMount.
+func BindUnmount(ctx context.Context, target string) error {
+	mounted, err := cmount.IsBindMounted(target)
+	if err != nil {
+		return fmt.Errorf("failed to check mount type: %w", err)
+	}
+
+	if mounted {
+		if err := cmount.UnmountBindFS(ctx, target); err != nil {
+			return fmt.Errorf("failed to unmount bindfs: %w", err)
+		}
+		return nil
+	}
+
+	if err := mount.CleanupMountPoint(target, mount.New(""), true); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func WaitForMount(ctx context.Context, path string, timeout time.Duration) error {
 	var elapsed time.Duration
 	interval := 10 * time.Millisecond
@@ -0,0 +1,13 @@
+package mounter
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestMounter(tst *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(tst, "Mounter")
+}
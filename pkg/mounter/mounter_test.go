@@ -0,0 +1,70 @@
+package mounter_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/mounter"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mounter", func() {
+	It("should default to s3fs without a mounter", func() {
+		m, err := mounter.NewMounter(&s3.FSMeta{}, &s3.S3Config{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m).To(BeAssignableToTypeOf(&mounter.S3FSMounter{}))
+	})
+
+	It("should prefer the mounter of the volume over the mounter of the config", func() {
+		m, err := mounter.NewMounter(&s3.FSMeta{Mounter: mounter.RcloneMounterType}, &s3.S3Config{Mounter: mounter.GeeseFSMounterType})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m).To(BeAssignableToTypeOf(&mounter.RcloneMounter{}))
+	})
+
+	It("should reject unknown mounters", func() {
+		_, err := mounter.NewMounter(&s3.FSMeta{Mounter: "s3fs-fuse"}, &s3.S3Config{})
+		Expect(err).To(HaveOccurred())
+		Expect(mounter.IsValidMounter("s3fs-fuse")).To(BeFalse())
+		Expect(mounter.IsValidMounter("")).To(BeTrue())
+	})
+
+	Context("RuntimeDir", func() {
+		var runtimeDir string
+
+		BeforeEach(func() {
+			runtimeDir = mounter.RuntimeDir
+
+			dir, err := os.MkdirTemp("", "mounter-test-*")
+			Expect(err).NotTo(HaveOccurred())
+			mounter.RuntimeDir = filepath.Join(dir, "runtime")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(filepath.Dir(mounter.RuntimeDir))
+			mounter.RuntimeDir = runtimeDir
+		})
+
+		It("should key runtime paths by the staging path", func() {
+			file := mounter.S3BackerAccessFile("/csi/staging/vol-a")
+			Expect(filepath.Dir(file)).To(Equal(mounter.RuntimeDir))
+			Expect(file).To(Equal(mounter.S3BackerAccessFile("/csi/staging/vol-a")))
+			Expect(file).NotTo(Equal(mounter.S3BackerAccessFile("/csi/staging/vol-b")))
+			Expect(file).NotTo(Equal(mounter.RuntimePath("native", "/csi/staging/vol-a")))
+		})
+
+		It("should write runtime files only readable by the plugin", func() {
+			file := mounter.S3BackerAccessFile("/csi/staging/vol-a")
+			Expect(mounter.WriteRuntimeFile(file, "access:secret")).To(Succeed())
+
+			info, err := os.Stat(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+
+			content, err := os.ReadFile(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("access:secret"))
+		})
+	})
+})
@@ -0,0 +1,97 @@
+package mounter
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	cmount "github.com/mwantia/nomad-csi-s3-plugin/pkg/common/mount"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+)
+
+// MountpointS3Mounter mounts volumes with AWS mountpoint-s3.
+// Mountpoint only supports sequential writes to new files and doesn't support renames,
+// so it is restricted to the access modes declared in mounterCapabilities.
+type MountpointS3Mounter struct {
+	Meta *s3.FSMeta
+	Cfg  *s3.S3Config
+}
+
+func NewMountpointS3Mounter(meta *s3.FSMeta, cfg *s3.S3Config) (Mounter, error) {
+	return &MountpointS3Mounter{
+		Meta: meta,
+		Cfg:  cfg,
+	}, nil
+}
+
+// Stage implements Mounter.
+func (m *MountpointS3Mounter) Stage(ctx context.Context, stagePath string, capability *csi.VolumeCapability) error {
+	args, err := m.Args(stagePath, capability)
+	if err != nil {
+		return err
+	}
+
+	return FuseMountWithEnv(ctx, stagePath, "mount-s3", args, []string{
+		fmt.Sprintf("AWS_ACCESS_KEY_ID=%s", m.Cfg.AccessKeyID),
+		fmt.Sprintf("AWS_SECRET_ACCESS_KEY=%s", m.Cfg.SecretAccessKey),
+	})
+}
+
+// Args returns the arguments of mount-s3 to stage the volume at stagePath.
+func (m *MountpointS3Mounter) Args(stagePath string, capability *csi.VolumeCapability) ([]string, error) {
+	options, err := GetMountOptions([]string{
+		"allow-other",
+		"allow-delete",
+		"allow-overwrite",
+		"file-mode=0666",
+		"dir-mode=0777",
+	}, m.Meta, m.Cfg, capability)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsReadOnly(capability) {
+		options.Set("read-only")
+	}
+
+	// mount-s3 rejects options that allow writes on read-only mounts
+	if options.Has("read-only") {
+		options.Remove("allow-delete")
+		options.Remove("allow-overwrite")
+	}
+
+	args := []string{
+		fmt.Sprintf("--endpoint-url=%s", m.Cfg.Endpoint),
+		"--force-path-style",
+	}
+	if len(m.Cfg.Region) > 0 {
+		args = append(args, fmt.Sprintf("--region=%s", m.Cfg.Region))
+	}
+	args = append(args, options.Args("--")...)
+	// mountpoint requires prefixes to end with a delimiter
+	if prefix := path.Join(m.Meta.Prefix, m.Meta.FSPath); len(prefix) > 0 {
+		args = append(args, fmt.Sprintf("--prefix=%s/", prefix))
+	}
+
+	return append(args, m.Meta.BucketName, stagePath), nil
+}
+
+// Unstage implements Mounter.
+func (m *MountpointS3Mounter) Unstage(ctx context.Context, stagePath string) error {
+	return FuseUnstage(ctx, stagePath)
+}
+
+func (m *MountpointS3Mounter) Mount(ctx context.Context, source string, target string, capability *csi.VolumeCapability, readonly bool) error {
+	options, err := BindFSOptions(m.Meta, readonly)
+	if err != nil {
+		return err
+	}
+
+	return cmount.BindFSMount(ctx, source, target, options)
+}
+
+func (m *MountpointS3Mounter) Unmount(ctx context.Context, target string) error {
+	return BindUnmount(ctx, target)
+}
@@ -0,0 +1,72 @@
+package mounter_test
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/mounter"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func capabilityOf(mode csi.VolumeCapability_AccessMode_Mode, flags ...string) *csi.VolumeCapability {
+	return &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{MountFlags: flags},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode},
+	}
+}
+
+var _ = Describe("MountpointS3Mounter", func() {
+	var m *mounter.MountpointS3Mounter
+
+	BeforeEach(func() {
+		m = &mounter.MountpointS3Mounter{
+			Meta: &s3.FSMeta{BucketName: "bucket", Prefix: "vol", FSPath: "fs", Mounter: mounter.MountpointS3MounterType},
+			Cfg:  &s3.S3Config{Endpoint: "http://s3:9000", Region: "us-east-1"},
+		}
+	})
+
+	It("should allow deletes and overwrites of writable volumes", func() {
+		args, err := m.Args("/staging", capabilityOf(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(args).To(Equal([]string{
+			"--endpoint-url=http://s3:9000",
+			"--force-path-style",
+			"--region=us-east-1",
+			"--allow-other",
+			"--allow-delete",
+			"--allow-overwrite",
+			"--file-mode=0666",
+			"--dir-mode=0777",
+			"--prefix=vol/fs/",
+			"bucket",
+			"/staging",
+		}))
+	})
+
+	It("should only pass read-only to reader-only volumes", func() {
+		args, err := m.Args("/staging", capabilityOf(csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(args).To(Equal([]string{
+			"--endpoint-url=http://s3:9000",
+			"--force-path-style",
+			"--region=us-east-1",
+			"--allow-other",
+			"--file-mode=0666",
+			"--dir-mode=0777",
+			"--read-only",
+			"--prefix=vol/fs/",
+			"bucket",
+			"/staging",
+		}))
+	})
+
+	It("should drop the write options of volumes mounted with the ro flag", func() {
+		args, err := m.Args("/staging", capabilityOf(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, "ro"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(args).To(ContainElement("--read-only"))
+		Expect(args).NotTo(ContainElement("--allow-delete"))
+		Expect(args).NotTo(ContainElement("--allow-overwrite"))
+	})
+})
@@ -0,0 +1,164 @@
+package mounter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	cmount "github.com/mwantia/nomad-csi-s3-plugin/pkg/common/mount"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/nativefs"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	"k8s.io/utils/mount"
+)
+
+// NativeMounter serves the volume from within the plugin process,
+// so it doesn't depend on any external fuse or bindfs binaries.
+type NativeMounter struct {
+	Meta   *s3.FSMeta
+	Cfg    *s3.S3Config
+	server *fuse.Server
+	fsys   *nativefs.FileSystem
+}
+
+func NewNativeMounter(meta *s3.FSMeta, cfg *s3.S3Config) (Mounter, error) {
+	return &NativeMounter{
+		Meta: meta,
+		Cfg:  cfg,
+	}, nil
+}
+
+// Stage implements Mounter.
+func (n *NativeMounter) Stage(ctx context.Context, stagePath string, capability *csi.VolumeCapability) error {
+	options, err := GetMountOptions(nil, n.Meta, n.Cfg, capability)
+	if err != nil {
+		return err
+	}
+
+	if IsReadOnly(capability) {
+		options.Set("ro")
+	}
+
+	client, err := s3.CreateClientFromConfig(n.Cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize S3 client: %w", err)
+	}
+
+	fsys := nativefs.New(client, n.Meta.BucketName, path.Join(n.Meta.Prefix, n.Meta.FSPath))
+	fsys.SetCapacity(n.Meta.CapacityBytes)
+
+	if err := n.applyOwnership(fsys); err != nil {
+		return err
+	}
+
+	// Files opened for writing are buffered within the runtime directory instead of the shared temp dir of the OS,
+	// where files left behind by a previous mount are removed, as they have never been uploaded
+	fsys.TempDir = RuntimePath("native", stagePath)
+	if err := os.RemoveAll(fsys.TempDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(fsys.TempDir, 0o700); err != nil {
+		return err
+	}
+
+	server, err := fsys.Mount(stagePath, options.Strings()...)
+	if err != nil {
+		os.RemoveAll(fsys.TempDir)
+		return err
+	}
+
+	if err := cmount.NewMountVerifier().WaitForMount(ctx, stagePath); err != nil {
+		server.Unmount()
+		os.RemoveAll(fsys.TempDir)
+		return err
+	}
+
+	n.server = server
+	n.fsys = fsys
+	return nil
+}
+
+// SetCapacity implements CapacitySetter.
+func (n *NativeMounter) SetCapacity(capacityBytes int64) {
+	if n.fsys != nil {
+		n.fsys.SetCapacity(capacityBytes)
+	}
+}
+
+// Unstage implements Mounter.
+func (n *NativeMounter) Unstage(ctx context.Context, stagePath string) error {
+	if n.server != nil {
+		if err := n.server.Unmount(); err != nil {
+			return fmt.Errorf("failed to unmount native filesystem: %w", err)
+		}
+
+		n.server = nil
+		n.fsys = nil
+	} else {
+		// The serving process is gone (e.g. after a restart), so only the stale mount remains
+		log.Printf("No native filesystem served for %s, removing stale mount", stagePath)
+
+		if err := mount.New("").Unmount(stagePath); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(RuntimePath("native", stagePath)); err != nil {
+		return err
+	}
+
+	if err := os.Remove(stagePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// applyOwnership applies the ownership parameters of the volume, as the native filesystem isn't published through bindfs.
+func (n *NativeMounter) applyOwnership(fsys *nativefs.FileSystem) error {
+	if len(n.Meta.UID) > 0 {
+		uid, err := LookupUID(n.Meta.UID)
+		if err != nil {
+			return err
+		}
+		fsys.Uid = uid
+	}
+
+	if len(n.Meta.GID) > 0 {
+		gid, err := LookupGID(n.Meta.GID)
+		if err != nil {
+			return err
+		}
+		fsys.Gid = gid
+	}
+
+	if len(n.Meta.FileMode) > 0 {
+		mode, err := ParseMode(n.Meta.FileMode)
+		if err != nil {
+			return err
+		}
+		fsys.FileMode = mode
+	}
+
+	if len(n.Meta.DirMode) > 0 {
+		mode, err := ParseMode(n.Meta.DirMode)
+		if err != nil {
+			return err
+		}
+		fsys.DirMode = mode
+	}
+
+	return nil
+}
+
+func (n *NativeMounter) Mount(ctx context.Context, source string, target string, capability *csi.VolumeCapability, readonly bool) error {
+	return cmount.BindMount(ctx, source, target, BindOptions(readonly))
+}
+
+func (n *NativeMounter) Unmount(ctx context.Context, target string) error {
+	return BindUnmount(ctx, target)
+}
@@ -0,0 +1,297 @@
+package mounter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+)
+
+// DeniedMountOptions can't be set through aliases, volumes or mount flags, as they either weaken
+// the isolation of the node or override options that are managed by the plugin itself.
+var DeniedMountOptions = map[string]bool{
+	// fuse
+	"allow_root": true,
+	"suid":       true,
+	"dev":        true,
+	// s3fs
+	"passwd_file":          true,
+	"url":                  true,
+	"endpoint":             true,
+	"ssl_verify_hostname":  true,
+	"no_check_certificate": true,
+	// rclone
+	"config":               true,
+	"daemon":               true,
+	"rc":                   true,
+	"rc-addr":              true,
+	"log-file":             true,
+	"cache-dir":            true,
+	"s3-provider":          true,
+	"s3-endpoint":          true,
+	"s3-region":            true,
+	"s3-env-auth":          true,
+	"s3-access-key-id":     true,
+	"s3-secret-access-key": true,
+	// geesefs and mountpoint-s3
+	"endpoint-url":    true,
+	"region":          true,
+	"prefix":          true,
+	"profile":         true,
+	"shared-config":   true,
+	"no-verify-ssl":   true,
+	"no-sign-request": true,
+}
+
+// mountOptionTranslations translate the generic options of aliases, volumes and mount flags into the options of each mounter.
+// Generic options without a translation aren't supported by the mounter, while an empty translation drops the option,
+// as it is already the default of the mounter. All other options are specific to a mounter and passed as is.
+var mountOptionTranslations = map[string]map[string]string{
+	S3FSMounterType: {
+		"ro": "ro", "rw": "rw", "allow_other": "allow_other", "uid": "uid", "gid": "gid", "umask": "umask",
+		"noatime": "noatime", "nodev": "nodev", "nosuid": "nosuid", "noexec": "noexec",
+	},
+	RcloneMounterType: {
+		"ro": "read-only", "rw": "", "allow_other": "allow-other", "uid": "uid", "gid": "gid", "umask": "umask",
+	},
+	GeeseFSMounterType: {
+		"ro": "ro", "rw": "", "allow_other": "allow_other", "uid": "uid", "gid": "gid",
+		"noatime": "noatime", "nodev": "nodev", "nosuid": "nosuid", "noexec": "noexec",
+	},
+	MountpointS3MounterType: {
+		"ro": "read-only", "rw": "", "allow_other": "allow-other", "uid": "uid", "gid": "gid",
+	},
+	NativeMounterType: {
+		"ro": "ro", "rw": "rw", "allow_other": "allow_other",
+		"noatime": "noatime", "nodev": "nodev", "nosuid": "nosuid", "noexec": "noexec",
+	},
+	S3BackerMounterType: {
+		"ro": "ro", "rw": "rw",
+		"noatime": "noatime", "nodev": "nodev", "nosuid": "nosuid", "noexec": "noexec",
+	},
+}
+
+// FuseMountOptions are passed as '-o' options by mounters, which otherwise only accept flags (e.g. geesefs).
+var FuseMountOptions = []string{"ro", "allow_other", "noatime", "nodev", "nosuid", "noexec"}
+
+// conflictingMountOptions are removed, whenever the option they conflict with is set.
+var conflictingMountOptions = map[string]string{
+	"ro": "rw",
+	"rw": "ro",
+}
+
+// MountOptions is an ordered set of options, where each option overrides any previous value of the same key.
+type MountOptions struct {
+	keys   []string
+	values map[string]string
+}
+
+// NewMountOptions parses options in the form of 'key' or 'key=value', which can also be comma-separated.
+func NewMountOptions(options ...string) *MountOptions {
+	o := &MountOptions{
+		values: make(map[string]string),
+	}
+	o.Merge(options...)
+
+	return o
+}
+
+// Merge sets all options, overriding the existing values of the same keys.
+func (o *MountOptions) Merge(options ...string) {
+	for _, option := range options {
+		for _, opt := range strings.Split(option, ",") {
+			o.Set(opt)
+		}
+	}
+}
+
+// Set adds a single option, leading dashes are ignored so that flags and fuse options are treated the same.
+func (o *MountOptions) Set(option string) {
+	key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+	key = strings.TrimLeft(key, "-")
+	if len(key) <= 0 {
+		return
+	}
+
+	if conflict, ok := conflictingMountOptions[key]; ok {
+		o.Remove(conflict)
+	}
+
+	// Overridden options are moved to the end to keep the order predictable
+	o.Remove(key)
+	o.keys = append(o.keys, key)
+	o.values[key] = value
+}
+
+func (o *MountOptions) Remove(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+	delete(o.values, key)
+}
+
+// Has returns true if an option with the key is set.
+func (o *MountOptions) Has(key string) bool {
+	_, ok := o.values[key]
+	return ok
+}
+
+// Extract removes the options with any of the keys and returns them.
+func (o *MountOptions) Extract(keys ...string) *MountOptions {
+	extracted := NewMountOptions()
+	for _, key := range keys {
+		value, ok := o.values[key]
+		if !ok {
+			continue
+		}
+
+		extracted.keys = append(extracted.keys, key)
+		extracted.values[key] = value
+		o.Remove(key)
+	}
+
+	return extracted
+}
+
+// Validate returns an error if any of the options is denied, including options scoped to a mounter.
+func (o *MountOptions) Validate() error {
+	for _, key := range o.keys {
+		_, key = scopeMountOption(key)
+		if DeniedMountOptions[strings.TrimLeft(key, "-")] {
+			return fmt.Errorf("mount option '%s' is not allowed", key)
+		}
+	}
+
+	return nil
+}
+
+// Strings returns all options in the form of 'key' or 'key=value'.
+func (o *MountOptions) Strings() []string {
+	options := make([]string, 0, len(o.keys))
+	for _, key := range o.keys {
+		if value := o.values[key]; len(value) > 0 {
+			options = append(options, fmt.Sprintf("%s=%s", key, value))
+		} else {
+			options = append(options, key)
+		}
+	}
+
+	return options
+}
+
+// Args returns all options as arguments, each prefixed with flag. If flag ends with '-', the
+// option is appended directly (e.g. '--opt=value'), otherwise it is passed as separate argument (e.g. '-o opt=value').
+func (o *MountOptions) Args(flag string) []string {
+	args := make([]string, 0, 2*len(o.keys))
+	for _, option := range o.Strings() {
+		if strings.HasSuffix(flag, "-") {
+			args = append(args, flag+option)
+		} else {
+			args = append(args, flag, option)
+		}
+	}
+
+	return args
+}
+
+// ValidateMountOptions returns an error if any of the options is denied.
+func ValidateMountOptions(options ...string) error {
+	return NewMountOptions(options...).Validate()
+}
+
+// scopeMountOption splits an option in the form of '<mounter>:<option>' into the mounter and the option.
+// Options without the name of a mounter as prefix aren't scoped (e.g. 'url=http://...').
+func scopeMountOption(option string) (string, string) {
+	if scope, scoped, ok := strings.Cut(option, ":"); ok {
+		if _, known := mountOptionTranslations[scope]; known {
+			return scope, scoped
+		}
+	}
+
+	return "", option
+}
+
+// TranslateMountOptions validates the options and translates them into the options of the mounter.
+// Options scoped to a mounter through a '<mounter>:' prefix are only applied to that mounter and passed as is,
+// while generic options are translated and rejected, if the mounter doesn't support them.
+func TranslateMountOptions(mounterType string, options ...string) ([]string, error) {
+	if len(mounterType) <= 0 {
+		mounterType = S3FSMounterType
+	}
+
+	if err := ValidateMountOptions(options...); err != nil {
+		return nil, err
+	}
+
+	translated := make([]string, 0, len(options))
+	for _, option := range options {
+		for _, opt := range strings.Split(option, ",") {
+			scope, opt := scopeMountOption(strings.TrimSpace(opt))
+			if len(scope) > 0 {
+				if scope == mounterType {
+					translated = append(translated, opt)
+				}
+				continue
+			}
+
+			key, value, hasValue := strings.Cut(opt, "=")
+			key = strings.TrimLeft(key, "-")
+			if !isGenericMountOption(key) {
+				translated = append(translated, opt)
+				continue
+			}
+
+			t, ok := mountOptionTranslations[mounterType][key]
+			if !ok {
+				return nil, fmt.Errorf("mount option '%s' is not supported by mounter '%s'", key, mounterType)
+			}
+
+			if len(t) <= 0 {
+				continue
+			}
+
+			if hasValue {
+				t = fmt.Sprintf("%s=%s", t, value)
+			}
+			translated = append(translated, t)
+		}
+	}
+
+	return translated, nil
+}
+
+func isGenericMountOption(key string) bool {
+	_, ok := mountOptionTranslations[S3FSMounterType][key]
+	return ok
+}
+
+// GetMountOptions merges the options of all sources in increasing order of precedence:
+// the defaults of the mounter, the alias, the 'mountOptions' volume parameter and the mount flags of the capability.
+// Only the defaults are passed as is, all other sources are translated for the mounter of the volume.
+func GetMountOptions(defaults []string, meta *s3.FSMeta, cfg *s3.S3Config, capability *csi.VolumeCapability) (*MountOptions, error) {
+	options := NewMountOptions(defaults...)
+	mounterType := GetMounterType(meta, cfg)
+
+	for _, source := range [][]string{
+		cfg.MountOptions,
+		meta.MountOptions,
+		capability.GetMount().GetMountFlags(),
+	} {
+		translated, err := TranslateMountOptions(mounterType, source...)
+		if err != nil {
+			return nil, err
+		}
+
+		options.Merge(translated...)
+	}
+
+	return options, nil
+}
@@ -0,0 +1,102 @@
+package mounter_test
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/mounter"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MountOptions", func() {
+	capability := func(flags ...string) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{
+					MountFlags: flags,
+				},
+			},
+		}
+	}
+
+	It("should parse comma-separated options and ignore leading dashes", func() {
+		options := mounter.NewMountOptions("allow_other,mp_umask=000", "--umask=022")
+		Expect(options.Strings()).To(Equal([]string{"allow_other", "mp_umask=000", "umask=022"}))
+	})
+
+	It("should override options of the same key in order", func() {
+		options := mounter.NewMountOptions("mp_umask=000", "allow_other", "mp_umask=022")
+		Expect(options.Strings()).To(Equal([]string{"allow_other", "mp_umask=022"}))
+	})
+
+	It("should remove conflicting options", func() {
+		options := mounter.NewMountOptions("rw", "ro")
+		Expect(options.Strings()).To(Equal([]string{"ro"}))
+	})
+
+	It("should format options as arguments", func() {
+		options := mounter.NewMountOptions("allow_other", "umask=000")
+		Expect(options.Args("-o")).To(Equal([]string{"-o", "allow_other", "-o", "umask=000"}))
+		Expect(options.Args("--")).To(Equal([]string{"--allow_other", "--umask=000"}))
+	})
+
+	It("should reject denied options", func() {
+		Expect(mounter.ValidateMountOptions("allow_other")).To(Succeed())
+		Expect(mounter.ValidateMountOptions("passwd_file=/etc/shadow")).NotTo(Succeed())
+		Expect(mounter.ValidateMountOptions("allow_other,suid")).NotTo(Succeed())
+	})
+
+	It("should merge all sources in order of precedence", func() {
+		options, err := mounter.GetMountOptions([]string{"allow_other", "mp_umask=000"},
+			&s3.FSMeta{MountOptions: []string{"mp_umask=022", "max_stat_cache_size=1000"}},
+			&s3.S3Config{MountOptions: []string{"max_stat_cache_size=100", "mp_umask=002"}},
+			capability("max_stat_cache_size=10000"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(options.Strings()).To(Equal([]string{"allow_other", "mp_umask=022", "max_stat_cache_size=10000"}))
+	})
+
+	It("should translate generic options for the mounter", func() {
+		options, err := mounter.TranslateMountOptions(mounter.RcloneMounterType, "ro,allow_other", "uid=1000", "rw", "vfs-cache-max-size=1G")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(options).To(Equal([]string{"read-only", "allow-other", "uid=1000", "vfs-cache-max-size=1G"}))
+	})
+
+	It("should reject generic options that aren't supported by the mounter", func() {
+		_, err := mounter.TranslateMountOptions(mounter.MountpointS3MounterType, "noatime")
+		Expect(err).To(HaveOccurred())
+		_, err = mounter.TranslateMountOptions(mounter.S3BackerMounterType, "allow_other")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should only apply scoped options to their mounter", func() {
+		options, err := mounter.TranslateMountOptions(mounter.GeeseFSMounterType, "s3fs:use_cache=/tmp", "geesefs:--memory-limit=1000", "stat-cache-ttl=1m")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(options).To(Equal([]string{"--memory-limit=1000", "stat-cache-ttl=1m"}))
+	})
+
+	It("should reject denied options scoped to a mounter", func() {
+		Expect(mounter.ValidateMountOptions("rclone:--rc-addr=:5572")).NotTo(Succeed())
+		_, err := mounter.TranslateMountOptions(mounter.RcloneMounterType, "cache-dir=/")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should translate the options of all sources for the mounter of the volume", func() {
+		options, err := mounter.GetMountOptions([]string{"allow-other"},
+			&s3.FSMeta{Mounter: mounter.RcloneMounterType, MountOptions: []string{"s3fs:use_cache=/tmp"}},
+			&s3.S3Config{MountOptions: []string{"umask=022"}},
+			capability("ro"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(options.Strings()).To(Equal([]string{"allow-other", "umask=022", "read-only"}))
+	})
+
+	It("should extract options", func() {
+		options := mounter.NewMountOptions("ro", "memory-limit=1000", "noatime")
+		Expect(options.Extract(mounter.FuseMountOptions...).Args("-o")).To(Equal([]string{"-o", "ro", "-o", "noatime"}))
+		Expect(options.Strings()).To(Equal([]string{"memory-limit=1000"}))
+	})
+
+	It("should reject denied mount flags of the capability", func() {
+		_, err := mounter.GetMountOptions(nil, &s3.FSMeta{}, &s3.S3Config{}, capability("url=http://attacker"))
+		Expect(err).To(HaveOccurred())
+	})
+})
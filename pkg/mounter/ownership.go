@@ -0,0 +1,202 @@
+package mounter
+
+import (
+	"fmt"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+)
+
+var ownerPattern = regexp.MustCompile(`^[a-zA-Z0-9_.][a-zA-Z0-9_.-]*$`)
+
+// HasOwnership returns true if any of the ownership or permission parameters is defined for the volume.
+func HasOwnership(meta *s3.FSMeta) bool {
+	return len(meta.UID) > 0 || len(meta.GID) > 0 || len(meta.FileMode) > 0 || len(meta.DirMode) > 0 || len(meta.UserMap) > 0
+}
+
+// ValidateOwnership returns an error if the ownership parameters are invalid or can't be applied by the mounter.
+func ValidateOwnership(meta *s3.FSMeta, mounterType string) error {
+	for name, owner := range map[string]string{"uid": meta.UID, "gid": meta.GID} {
+		if len(owner) > 0 && !ownerPattern.MatchString(owner) {
+			return fmt.Errorf("invalid %s '%s'", name, owner)
+		}
+	}
+
+	for name, mode := range map[string]string{"fileMode": meta.FileMode, "dirMode": meta.DirMode} {
+		if _, err := ParseMode(mode); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+
+	if _, err := ParseUserMap(meta.UserMap); err != nil {
+		return fmt.Errorf("invalid userMap: %w", err)
+	}
+
+	switch mounterType {
+	case S3BackerMounterType:
+		// The formatted filesystem stores ownership and permissions itself
+		if HasOwnership(meta) {
+			return fmt.Errorf("ownership parameters are not supported by mounter '%s'", mounterType)
+		}
+	case NativeMounterType:
+		if len(meta.UserMap) > 0 {
+			return fmt.Errorf("userMap is not supported by mounter '%s'", mounterType)
+		}
+	}
+
+	return nil
+}
+
+// OwnershipOptions translates the ownership parameters of the volume into bindfs options.
+func OwnershipOptions(meta *s3.FSMeta) ([]string, error) {
+	options := make([]string, 0)
+
+	if len(meta.UID) > 0 {
+		options = append(options, fmt.Sprintf("--force-user=%s", meta.UID))
+	}
+	if len(meta.GID) > 0 {
+		options = append(options, fmt.Sprintf("--force-group=%s", meta.GID))
+	}
+
+	perms, err := PermsRules(meta.FileMode, meta.DirMode)
+	if err != nil {
+		return nil, err
+	}
+	if len(perms) > 0 {
+		options = append(options, fmt.Sprintf("--perms=%s", perms))
+	}
+
+	userMap, err := ParseUserMap(meta.UserMap)
+	if err != nil {
+		return nil, err
+	}
+	if len(userMap) > 0 {
+		options = append(options, fmt.Sprintf("--map=%s", strings.Join(userMap, ":")))
+	}
+
+	return options, nil
+}
+
+// ParseMode parses an octal permission mode (e.g. '0640'), an empty mode is returned as 0.
+func ParseMode(mode string) (uint32, error) {
+	if len(mode) <= 0 {
+		return 0, nil
+	}
+
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0o777 {
+		return 0, fmt.Errorf("mode '%s' must be an octal value between 0000 and 0777", mode)
+	}
+
+	return uint32(m), nil
+}
+
+// PermsRules returns the bindfs permission rules, which apply fileMode to files and dirMode to directories only.
+func PermsRules(fileMode, dirMode string) (string, error) {
+	rules := make([]string, 0)
+
+	for _, perms := range []struct {
+		filter string
+		mode   string
+	}{
+		{filter: "f", mode: fileMode},
+		{filter: "d", mode: dirMode},
+	} {
+		if len(perms.mode) <= 0 {
+			continue
+		}
+
+		m, err := ParseMode(perms.mode)
+		if err != nil {
+			return "", err
+		}
+
+		for i, class := range []string{"u", "g", "o"} {
+			bits := (m >> (3 * (2 - i))) & 0o7
+			rules = append(rules, fmt.Sprintf("%s%s=%s", class, perms.filter, permString(bits)))
+		}
+	}
+
+	return strings.Join(rules, ":"), nil
+}
+
+func permString(bits uint32) string {
+	perm := ""
+	for i, p := range []string{"r", "w", "x"} {
+		if bits&(1<<(2-i)) != 0 {
+			perm += p
+		}
+	}
+
+	return perm
+}
+
+// ParseUserMap parses a list of 'from/to' mappings separated by ':' or ',', where groups are prefixed with '@'.
+func ParseUserMap(userMap string) ([]string, error) {
+	mappings := make([]string, 0)
+
+	for _, mapping := range strings.FieldsFunc(userMap, func(r rune) bool { return r == ':' || r == ',' }) {
+		from, to, ok := strings.Cut(strings.TrimSpace(mapping), "/")
+		if !ok {
+			return nil, fmt.Errorf("mapping '%s' must be in the form 'from/to'", mapping)
+		}
+
+		group := strings.HasPrefix(from, "@")
+		if group != strings.HasPrefix(to, "@") {
+			return nil, fmt.Errorf("mapping '%s' can't map between users and groups", mapping)
+		}
+
+		if !ownerPattern.MatchString(strings.TrimPrefix(from, "@")) || !ownerPattern.MatchString(strings.TrimPrefix(to, "@")) {
+			return nil, fmt.Errorf("mapping '%s' contains an invalid name", mapping)
+		}
+
+		mappings = append(mappings, from+"/"+to)
+	}
+
+	return mappings, nil
+}
+
+// LookupUID resolves a user name or numeric id into a uid.
+func LookupUID(owner string) (uint32, error) {
+	return lookupID(owner, func(name string) (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+
+		return u.Uid, nil
+	})
+}
+
+// LookupGID resolves a group name or numeric id into a gid.
+func LookupGID(owner string) (uint32, error) {
+	return lookupID(owner, func(name string) (string, error) {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err
+		}
+
+		return g.Gid, nil
+	})
+}
+
+func lookupID(owner string, lookup func(string) (string, error)) (uint32, error) {
+	if id, err := strconv.ParseUint(owner, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+
+	resolved, err := lookup(owner)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve '%s': %w", owner, err)
+	}
+
+	id, err := strconv.ParseUint(resolved, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve '%s': %w", owner, err)
+	}
+
+	return uint32(id), nil
+}
@@ -0,0 +1,45 @@
+package mounter_test
+
+import (
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/mounter"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ownership", func() {
+	It("should translate ownership parameters into bindfs options", func() {
+		options, err := mounter.OwnershipOptions(&s3.FSMeta{
+			UID:      "1000",
+			GID:      "users",
+			FileMode: "0640",
+			DirMode:  "0750",
+			UserMap:  "root/1000,@root/@users",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(options).To(Equal([]string{
+			"--force-user=1000",
+			"--force-group=users",
+			"--perms=uf=rw:gf=r:of=:ud=rwx:gd=rx:od=",
+			"--map=root/1000:@root/@users",
+		}))
+	})
+
+	It("should return no options without ownership parameters", func() {
+		options, err := mounter.OwnershipOptions(&s3.FSMeta{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(options).To(BeEmpty())
+	})
+
+	It("should reject invalid modes and mappings", func() {
+		Expect(mounter.ValidateOwnership(&s3.FSMeta{FileMode: "0999"}, mounter.S3FSMounterType)).To(HaveOccurred())
+		Expect(mounter.ValidateOwnership(&s3.FSMeta{UserMap: "root/@users"}, mounter.S3FSMounterType)).To(HaveOccurred())
+		Expect(mounter.ValidateOwnership(&s3.FSMeta{UID: "1000,allow_root"}, mounter.S3FSMounterType)).To(HaveOccurred())
+	})
+
+	It("should reject ownership parameters for mounters that can't apply them", func() {
+		Expect(mounter.ValidateOwnership(&s3.FSMeta{UID: "1000"}, mounter.S3BackerMounterType)).To(HaveOccurred())
+		Expect(mounter.ValidateOwnership(&s3.FSMeta{UserMap: "root/1000"}, mounter.NativeMounterType)).To(HaveOccurred())
+		Expect(mounter.ValidateOwnership(&s3.FSMeta{UID: "1000"}, mounter.NativeMounterType)).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,117 @@
+package mounter
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	cmount "github.com/mwantia/nomad-csi-s3-plugin/pkg/common/mount"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+)
+
+const (
+	DefaultVfsCacheMode = "writes"
+)
+
+// VfsCacheModes lists the values accepted by rclone for '--vfs-cache-mode'.
+var VfsCacheModes = []string{"off", "minimal", "writes", "full"}
+
+type RcloneMounter struct {
+	Meta *s3.FSMeta
+	Cfg  *s3.S3Config
+}
+
+func NewRcloneMounter(meta *s3.FSMeta, cfg *s3.S3Config) (Mounter, error) {
+	if !IsValidVfsCacheMode(meta.VfsCacheMode) {
+		return nil, fmt.Errorf("invalid vfs cache mode '%s', must be one of %v", meta.VfsCacheMode, VfsCacheModes)
+	}
+
+	return &RcloneMounter{
+		Meta: meta,
+		Cfg:  cfg,
+	}, nil
+}
+
+// IsValidVfsCacheMode returns true if mode is empty or one of VfsCacheModes.
+func IsValidVfsCacheMode(mode string) bool {
+	if len(mode) <= 0 {
+		return true
+	}
+
+	for _, m := range VfsCacheModes {
+		if m == mode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Stage implements Mounter.
+func (r *RcloneMounter) Stage(ctx context.Context, stagePath string, capability *csi.VolumeCapability) error {
+	cacheMode := r.Meta.VfsCacheMode
+	if len(cacheMode) <= 0 {
+		cacheMode = DefaultVfsCacheMode
+	}
+
+	options, err := GetMountOptions([]string{
+		"allow-other",
+		"umask=000",
+		fmt.Sprintf("vfs-cache-mode=%s", cacheMode),
+	}, r.Meta, r.Cfg, capability)
+	if err != nil {
+		return err
+	}
+
+	if IsReadOnly(capability) {
+		options.Set("read-only")
+	}
+
+	env := []string{
+		fmt.Sprintf("RCLONE_S3_ACCESS_KEY_ID=%s", r.Cfg.AccessKeyID),
+		fmt.Sprintf("RCLONE_S3_SECRET_ACCESS_KEY=%s", r.Cfg.SecretAccessKey),
+	}
+
+	switch r.Meta.Encryption {
+	case s3.EncryptionSSES3:
+		options.Set("s3-server-side-encryption=AES256")
+	case s3.EncryptionSSEKMS:
+		options.Set("s3-server-side-encryption=aws:kms")
+		options.Set(fmt.Sprintf("s3-sse-kms-key-id=%s", r.Meta.KMSKeyID))
+	case s3.EncryptionSSEC:
+		options.Set("s3-sse-customer-algorithm=AES256")
+		// Like the credentials, the customer key isn't passed as argument
+		env = append(env, fmt.Sprintf("RCLONE_S3_SSE_CUSTOMER_KEY=%s", r.Cfg.SSECustomerKey))
+	}
+
+	// The remote is created on the fly, so rclone doesn't require any config file
+	return FuseMountWithEnv(ctx, stagePath, "rclone", append([]string{
+		"mount",
+		fmt.Sprintf(":s3:%s", path.Join(r.Meta.BucketName, r.Meta.Prefix, r.Meta.FSPath)),
+		stagePath,
+		"--daemon",
+		"--s3-provider=Other",
+		fmt.Sprintf("--s3-endpoint=%s", r.Cfg.Endpoint),
+		fmt.Sprintf("--s3-region=%s", r.Cfg.Region),
+	}, options.Args("--")...), env)
+}
+
+// Unstage implements Mounter.
+func (r *RcloneMounter) Unstage(ctx context.Context, stagePath string) error {
+	return FuseUnstage(ctx, stagePath)
+}
+
+func (r *RcloneMounter) Mount(ctx context.Context, source string, target string, capability *csi.VolumeCapability, readonly bool) error {
+	options, err := BindFSOptions(r.Meta, readonly)
+	if err != nil {
+		return err
+	}
+
+	return cmount.BindFSMount(ctx, source, target, options)
+}
+
+func (r *RcloneMounter) Unmount(ctx context.Context, target string) error {
+	return BindUnmount(ctx, target)
+}
@@ -0,0 +1,253 @@
+package mounter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	cmount "github.com/mwantia/nomad-csi-s3-plugin/pkg/common/mount"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	"k8s.io/mount-utils"
+	utilexec "k8s.io/utils/exec"
+)
+
+const (
+	DefaultS3BackerBlockSize = "1M"
+	DefaultS3BackerFsType    = "ext4"
+	// Name of the file exposed by s3backer within its fuse mount
+	S3BackerFileName = "file"
+)
+
+// S3BackerMounter exposes the volume as block device, which is built from fixed-size objects by s3backer
+// and attached through a loop device. The device is either published as is or formatted with a real
+// filesystem, so that tasks get full POSIX semantics including locking and atomic renames.
+type S3BackerMounter struct {
+	Meta   *s3.FSMeta
+	Cfg    *s3.S3Config
+	device string
+}
+
+func NewS3BackerMounter(meta *s3.FSMeta, cfg *s3.S3Config) (Mounter, error) {
+	if meta.CapacityBytes <= 0 {
+		return nil, fmt.Errorf("s3backer requires the volume to be created with a capacity")
+	}
+
+	return &S3BackerMounter{
+		Meta: meta,
+		Cfg:  cfg,
+	}, nil
+}
+
+// S3BackerBackingPath returns the path s3backer exposes its backing file in, for the staging path.
+func S3BackerBackingPath(stagePath string) string {
+	return stagePath + ".s3backer"
+}
+
+// S3BackerAccessFile returns the path of the file containing the credentials s3backer is started with, for the staging path.
+func S3BackerAccessFile(stagePath string) string {
+	return RuntimePath("s3backer", stagePath)
+}
+
+// Stage implements Mounter.
+func (s *S3BackerMounter) Stage(ctx context.Context, stagePath string, capability *csi.VolumeCapability) error {
+	// Options are applied when mounting the formatted filesystem, as s3backer itself is managed by the plugin
+	options, err := GetMountOptions(nil, s.Meta, s.Cfg, capability)
+	if err != nil {
+		return err
+	}
+
+	backing := S3BackerBackingPath(stagePath)
+	if err := os.MkdirAll(backing, 0o750); err != nil {
+		return fmt.Errorf("failed to create backing directory: %w", err)
+	}
+
+	// The file is keyed by the staging path, so that it is removed on unstage even after a restart of the plugin
+	accessFile := S3BackerAccessFile(stagePath)
+	if err := WriteRuntimeFile(accessFile, s.Cfg.AccessKeyID+":"+s.Cfg.SecretAccessKey); err != nil {
+		return fmt.Errorf("failed to write access file: %w", err)
+	}
+
+	blockSize := s.Meta.BlockSize
+	if len(blockSize) <= 0 {
+		blockSize = DefaultS3BackerBlockSize
+	}
+
+	args := []string{
+		fmt.Sprintf("--accessFile=%s", accessFile),
+		fmt.Sprintf("--baseURL=%s/", strings.TrimSuffix(s.Cfg.Endpoint, "/")),
+		fmt.Sprintf("--size=%d", s.Meta.CapacityBytes),
+		fmt.Sprintf("--blockSize=%s", blockSize),
+	}
+	if len(s.Cfg.Region) > 0 {
+		args = append(args, fmt.Sprintf("--region=%s", s.Cfg.Region))
+	}
+	if prefix := path.Join(s.Meta.Prefix, s.Meta.FSPath); len(prefix) > 0 {
+		args = append(args, fmt.Sprintf("--prefix=%s/", prefix))
+	}
+	if IsReadOnly(capability) {
+		args = append(args, "--readOnly")
+		options.Set("ro")
+	}
+
+	if err := FuseMount(ctx, backing, "s3backer", append(args, s.Meta.BucketName, backing)); err != nil {
+		removeAccessFile(accessFile)
+		return err
+	}
+
+	device, err := AttachLoopDevice(ctx, path.Join(backing, S3BackerFileName), IsReadOnly(capability))
+	if err != nil {
+		FuseUnstage(ctx, backing)
+		removeAccessFile(accessFile)
+		return err
+	}
+
+	s.device = device
+	log.Printf("Attached s3backer file of %s to %s", stagePath, device)
+
+	if capability.GetBlock() != nil {
+		return nil
+	}
+
+	fsType := capability.GetMount().GetFsType()
+	if len(fsType) <= 0 {
+		fsType = DefaultS3BackerFsType
+	}
+
+	mounter := mount.NewSafeFormatAndMount(mount.New(""), utilexec.New())
+	if err := mounter.FormatAndMount(device, stagePath, fsType, options.Strings()); err != nil {
+		DetachLoopDevice(ctx, device)
+		FuseUnstage(ctx, backing)
+		removeAccessFile(accessFile)
+
+		return fmt.Errorf("failed to format and mount %s: %w", device, err)
+	}
+
+	return nil
+}
+
+// Unstage implements Mounter.
+func (s *S3BackerMounter) Unstage(ctx context.Context, stagePath string) error {
+	backing := S3BackerBackingPath(stagePath)
+
+	if err := mount.CleanupMountPoint(stagePath, mount.New(""), true); err != nil {
+		return err
+	}
+
+	device, err := s.getDevice(ctx, backing)
+	if err != nil {
+		return err
+	}
+
+	if len(device) > 0 {
+		if err := DetachLoopDevice(ctx, device); err != nil {
+			return err
+		}
+		s.device = ""
+	}
+
+	if err := FuseUnstage(ctx, backing); err != nil {
+		return err
+	}
+
+	removeAccessFile(S3BackerAccessFile(stagePath))
+
+	return nil
+}
+
+func removeAccessFile(accessFile string) {
+	if err := os.Remove(accessFile); err != nil && !os.IsNotExist(err) {
+		log.Printf("Unable to remove access file %s: %v", accessFile, err)
+	}
+}
+
+func (s *S3BackerMounter) Mount(ctx context.Context, source string, target string, capability *csi.VolumeCapability, readonly bool) error {
+	if capability.GetBlock() == nil {
+		return cmount.BindMount(ctx, source, target, BindOptions(readonly))
+	}
+
+	device, err := s.getDevice(ctx, S3BackerBackingPath(source))
+	if err != nil {
+		return err
+	}
+
+	if len(device) <= 0 {
+		return fmt.Errorf("no device attached for staging path %s", source)
+	}
+
+	// Block volumes are published as file, to which the device is bind mounted
+	if err := os.MkdirAll(path.Dir(target), 0o750); err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE, 0o660)
+	if err != nil {
+		return fmt.Errorf("failed to create target file: %w", err)
+	}
+	file.Close()
+
+	if err := mount.New("").Mount(device, target, "", append([]string{"bind"}, BindOptions(readonly)...)); err != nil {
+		return fmt.Errorf("failed to bind device %s: %w", device, err)
+	}
+
+	return nil
+}
+
+func (s *S3BackerMounter) Unmount(ctx context.Context, target string) error {
+	return BindUnmount(ctx, target)
+}
+
+// getDevice returns the loop device attached to the backing file, even if it has been attached by a previous process.
+func (s *S3BackerMounter) getDevice(ctx context.Context, backing string) (string, error) {
+	if len(s.device) > 0 {
+		return s.device, nil
+	}
+
+	return FindLoopDevice(ctx, path.Join(backing, S3BackerFileName))
+}
+
+func AttachLoopDevice(ctx context.Context, file string, readonly bool) (string, error) {
+	args := []string{"--find", "--show"}
+	if readonly {
+		args = append(args, "--read-only")
+	}
+
+	out, err := exec.CommandContext(ctx, "losetup", append(args, file)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to attach loop device to %s: %v - output: %s", file, err, string(out))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+func FindLoopDevice(ctx context.Context, file string) (string, error) {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return "", nil
+	}
+
+	out, err := exec.CommandContext(ctx, "losetup", "--list", "--noheadings", "--output", "NAME", "--associated", file).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to find loop device of %s: %v - output: %s", file, err, string(out))
+	}
+
+	devices := strings.Fields(string(out))
+	if len(devices) <= 0 {
+		return "", nil
+	}
+
+	return devices[0], nil
+}
+
+func DetachLoopDevice(ctx context.Context, device string) error {
+	out, err := exec.CommandContext(ctx, "losetup", "--detach", device).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to detach loop device %s: %v - output: %s", device, err, string(out))
+	}
+
+	return nil
+}
@@ -4,18 +4,21 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"log"
 	"os"
 	"path"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
 	cmount "github.com/mwantia/nomad-csi-s3-plugin/pkg/common/mount"
 
 	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
-	"k8s.io/utils/mount"
 )
 
 type S3FSMounter struct {
 	Meta *s3.FSMeta
 	Cfg  *s3.S3Config
+	// Key file of volumes encrypted with a customer key, which is removed when the volume is unstaged
+	keyFile string
 }
 
 func NewS3FSMounter(meta *s3.FSMeta, cfg *s3.S3Config) (Mounter, error) {
@@ -26,60 +29,120 @@ func NewS3FSMounter(meta *s3.FSMeta, cfg *s3.S3Config) (Mounter, error) {
 }
 
 // Stage implements Mounter.
-func (s *S3FSMounter) Stage(ctx context.Context, stagePath string) error {
+func (s *S3FSMounter) Stage(ctx context.Context, stagePath string, capability *csi.VolumeCapability) error {
+	options, err := GetMountOptions([]string{
+		"use_path_request_style",
+		"allow_other",
+		"mp_umask=000",
+	}, s.Meta, s.Cfg, capability)
+	if err != nil {
+		return err
+	}
+
+	if IsReadOnly(capability) {
+		options.Set("ro")
+	}
+
+	if err := s.setEncryption(options); err != nil {
+		return err
+	}
+
 	passfile, err := WriteS3FSPassFile(s.Cfg.AccessKeyID + ":" + s.Cfg.SecretAccessKey)
 	if err != nil {
+		s.removeKeyFile()
 		return err
 	}
 
-	return FuseMount(ctx, stagePath, "s3fs", []string{
+	err = FuseMount(ctx, stagePath, "s3fs", append([]string{
 		fmt.Sprintf("%s:/%s", s.Meta.BucketName, path.Join(s.Meta.Prefix, s.Meta.FSPath)),
 		stagePath,
 		"-o", fmt.Sprintf("url=%s", s.Cfg.Endpoint),
 		"-o", fmt.Sprintf("endpoint=%s", s.Cfg.Region),
 		"-o", fmt.Sprintf("passwd_file=%s", passfile),
-		"-o", "use_path_request_style",
-		"-o", "allow_other",
-		"-o", "mp_umask=000",
-	})
+	}, options.Args("-o")...))
+	if err != nil {
+		s.removeKeyFile()
+	}
+
+	return err
+}
+
+// setEncryption enables the encryption of the volume for all objects written by s3fs.
+func (s *S3FSMounter) setEncryption(options *MountOptions) error {
+	switch s.Meta.Encryption {
+	case s3.EncryptionSSES3:
+		options.Set("use_sse")
+	case s3.EncryptionSSEKMS:
+		options.Set(fmt.Sprintf("use_sse=kmsid:%s", s.Meta.KMSKeyID))
+	case s3.EncryptionSSEC:
+		// s3fs only reads customer keys from a file
+		s.removeKeyFile()
+		keyfile, err := WriteKeyFile(s.Cfg.SSECustomerKey)
+		if err != nil {
+			return err
+		}
+		s.keyFile = keyfile
+		options.Set(fmt.Sprintf("use_sse=custom:%s", keyfile))
+	}
+
+	return nil
 }
 
 // Unstage implements Mounter.
 func (s *S3FSMounter) Unstage(ctx context.Context, stagePath string) error {
-	if err := FuseUnmount(ctx, stagePath); err != nil {
+	if err := FuseUnstage(ctx, stagePath); err != nil {
 		return err
 	}
 
-	if err := os.Remove(stagePath); err != nil && !os.IsNotExist(err) {
-		return err
+	s.removeKeyFile()
+	return nil
+}
+
+func (s *S3FSMounter) removeKeyFile() {
+	if len(s.keyFile) <= 0 {
+		return
 	}
 
-	return nil
+	if err := os.Remove(s.keyFile); err != nil && !os.IsNotExist(err) {
+		log.Printf("Unable to remove key file %s: %v", s.keyFile, err)
+	}
+	s.keyFile = ""
 }
 
-func (s *S3FSMounter) Mount(ctx context.Context, source string, target string) error {
-	return cmount.BindFSMount(ctx, source, target)
+func (s *S3FSMounter) Mount(ctx context.Context, source string, target string, capability *csi.VolumeCapability, readonly bool) error {
+	options, err := BindFSOptions(s.Meta, readonly)
+	if err != nil {
+		return err
+	}
+
+	return cmount.BindFSMount(ctx, source, target, options)
 	// return FuseMount(ctx, target, "bindfs", []string{ source,target})
 }
 
 func (s *S3FSMounter) Unmount(ctx context.Context, target string) error {
-	mounted, err := cmount.IsBindMounted(target)
-	if err != nil {
-		return fmt.Errorf("failed to check mount type: %w", err)
+	return BindUnmount(ctx, target)
+}
+
+// WriteKeyFile writes content to a new file with a random name within RuntimeDir, which is only readable by the plugin.
+// The caller is responsible for removing the file once it is no longer needed.
+func WriteKeyFile(content string) (string, error) {
+	if err := os.MkdirAll(RuntimeDir, 0o700); err != nil {
+		return "", err
 	}
 
-	if mounted {
-		if err := cmount.UnmountBindFS(ctx, target); err != nil {
-			return fmt.Errorf("failed to unmount bindfs: %w", err)
-		}
-		return nil
+	// Files created by CreateTemp are only readable by their owner
+	keyFile, err := os.CreateTemp(RuntimeDir, "key-*")
+	if err != nil {
+		return "", err
 	}
+	defer keyFile.Close()
 
-	if err := mount.CleanupMountPoint(target, mount.New(""), true); err != nil {
-		return err
+	if _, err := keyFile.WriteString(content); err != nil {
+		os.Remove(keyFile.Name())
+		return "", err
 	}
 
-	return nil
+	return keyFile.Name(), nil
 }
 
 func WriteS3FSPassFile(content string) (string, error) {
@@ -0,0 +1,282 @@
+package mounter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/mitchellh/go-ps"
+	cmount "github.com/mwantia/nomad-csi-s3-plugin/pkg/common/mount"
+)
+
+const (
+	DefaultProbeInterval = 15 * time.Second
+	DefaultProbeTimeout  = 10 * time.Second
+)
+
+// RepairFunc restages a volume and publishes all of its targets again.
+type RepairFunc func(ctx context.Context) error
+
+// Event describes a restart of a supervised mount, which has failed if Err is set.
+type Event struct {
+	Key     string
+	Attempt int
+	Time    time.Time
+	Err     error
+}
+
+// EventFunc receives the restarts of all supervised mounts.
+type EventFunc func(event Event)
+
+// Supervisor periodically probes the mounts of staged volumes and repairs them,
+// once their fuse process died or the mount stopped responding.
+type Supervisor struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	Backoff  *cmount.ExponentialBackoff
+	// Called after every restart, which has to be set before the supervisor is run
+	OnEvent EventFunc
+
+	mu      sync.Mutex
+	watches map[string]*watch
+}
+
+type watch struct {
+	paths    []string
+	pids     map[string]int
+	repair   RepairFunc
+	failures int
+	next     time.Time
+	// Set while a probe is still waiting for a hung mount
+	probing atomic.Bool
+}
+
+func NewSupervisor() *Supervisor {
+	return &Supervisor{
+		Interval: DefaultProbeInterval,
+		Timeout:  DefaultProbeTimeout,
+		Backoff: &cmount.ExponentialBackoff{
+			InitialInterval: 5 * time.Second,
+			MaxInterval:     5 * time.Minute,
+			Multiplier:      2,
+		},
+		watches: make(map[string]*watch),
+	}
+}
+
+// SupervisedPaths returns the paths that have to be probed to determine the health of a staged volume.
+func SupervisedPaths(m Mounter, stagePath string) []string {
+	// The fuse process of s3backer serves the backing file, while the staging path is a regular filesystem
+	if _, ok := m.(*S3BackerMounter); ok {
+		return []string{stagePath, S3BackerBackingPath(stagePath)}
+	}
+
+	return []string{stagePath}
+}
+
+// Watch starts supervising the mounts at paths under key, replacing any previous watch of the same key.
+func (s *Supervisor) Watch(key string, paths []string, repair RepairFunc) {
+	w := &watch{
+		paths:  paths,
+		pids:   make(map[string]int),
+		repair: repair,
+		next:   time.Now().Add(s.Interval),
+	}
+	w.track()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.watches[key] = w
+}
+
+// Forget stops supervising the mounts of key.
+func (s *Supervisor) Forget(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.watches, key)
+}
+
+// Run probes all watched mounts until ctx is cancelled.
+func (s *Supervisor) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.probeAll(ctx)
+		}
+	}
+}
+
+func (s *Supervisor) probeAll(ctx context.Context) {
+	s.mu.Lock()
+	watches := make(map[string]*watch, len(s.watches))
+	for key, w := range s.watches {
+		watches[key] = w
+	}
+	s.mu.Unlock()
+
+	for key, w := range watches {
+		if time.Now().Before(w.next) || w.probing.Load() {
+			continue
+		}
+
+		err := s.probe(w)
+		if err == nil {
+			w.failures = 0
+			w.next = time.Now()
+			continue
+		}
+
+		log.Printf("supervisor: mount of %s is unhealthy: %v", key, err)
+		s.restart(ctx, key, w)
+	}
+}
+
+func (s *Supervisor) restart(ctx context.Context, key string, w *watch) {
+	w.failures++
+	log.Printf("supervisor: restarting %s (attempt %d)", key, w.failures)
+
+	err := w.repair(ctx)
+	s.emit(Event{
+		Key:     key,
+		Attempt: w.failures,
+		Time:    time.Now(),
+		Err:     err,
+	})
+
+	if err != nil {
+		interval := s.Backoff.Interval(w.failures)
+		w.next = time.Now().Add(interval)
+
+		log.Printf("supervisor: failed to restart %s, retrying in %s: %v", key, interval, err)
+		return
+	}
+
+	log.Printf("supervisor: restarted %s", key)
+
+	w.failures = 0
+	w.next = time.Now()
+	w.track()
+}
+
+func (s *Supervisor) emit(event Event) {
+	if s.OnEvent != nil {
+		s.OnEvent(event)
+	}
+}
+
+// probe returns an error if any fuse process has exited or a path doesn't respond within the timeout.
+func (s *Supervisor) probe(w *watch) error {
+	for _, path := range w.paths {
+		if pid, ok := w.pids[path]; ok && !isProcessAlive(pid, path) {
+			return fmt.Errorf("fuse process %d of %s has exited", pid, path)
+		}
+
+		if err := s.stat(w, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Supervisor) stat(w *watch, path string) error {
+	w.probing.Store(true)
+	return ProbeMount(path, s.Timeout, func() {
+		w.probing.Store(false)
+	})
+}
+
+// ProbeMount returns an error if path can't be accessed within timeout, e.g. because its fuse process hangs.
+// As a hung probe can't be cancelled, done is called once it eventually returns.
+func ProbeMount(path string, timeout time.Duration, done func()) error {
+	result := make(chan error, 1)
+
+	go func() {
+		if done != nil {
+			defer done()
+		}
+
+		stat := syscall.Statfs_t{}
+		result <- syscall.Statfs(path, &stat)
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			return fmt.Errorf("failed to probe %s: %w", path, err)
+		}
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("probe of %s timed out after %s", path, timeout)
+	}
+}
+
+// track remembers the fuse process serving each path, which is best effort as in-process mounts have none.
+func (w *watch) track() {
+	w.pids = make(map[string]int)
+	for _, path := range w.paths {
+		if pid := findMountProcess(path); pid > 0 {
+			w.pids[path] = pid
+		}
+	}
+}
+
+// findMountProcess returns the pid of the fuse process serving path,
+// ignoring bindfs processes that only use path as source.
+func findMountProcess(path string) int {
+	processes, err := ps.Processes()
+	if err != nil {
+		return 0
+	}
+
+	for _, p := range processes {
+		if p.Executable() == "bindfs" {
+			continue
+		}
+
+		cmdLine, err := GetCmdLine(p.Pid())
+		if err != nil {
+			continue
+		}
+
+		for _, arg := range strings.Split(cmdLine, "\x00") {
+			if filepath.Clean(arg) == filepath.Clean(path) {
+				return p.Pid()
+			}
+		}
+	}
+
+	return 0
+}
+
+func isProcessAlive(pid int, path string) bool {
+	cmdLine, err := GetCmdLine(pid)
+	if err != nil || cmdLine == "" {
+		return false
+	}
+
+	// The pid may have been reused by an unrelated process
+	return strings.Contains(cmdLine, path)
+}
+
+// LazyUnmount detaches the mount at path, even if it is busy or its fuse process doesn't respond anymore.
+func LazyUnmount(path string) error {
+	if err := syscall.Unmount(path, syscall.MNT_DETACH); err != nil && err != syscall.EINVAL && err != syscall.ENOENT {
+		return fmt.Errorf("failed to detach %s: %w", path, err)
+	}
+
+	return nil
+}
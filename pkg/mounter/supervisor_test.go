@@ -0,0 +1,110 @@
+package mounter_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/mounter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Supervisor", func() {
+	var (
+		supervisor *mounter.Supervisor
+		cancel     context.CancelFunc
+		eventsMu   sync.Mutex
+		events     []mounter.Event
+	)
+
+	recorded := func() []mounter.Event {
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+
+		return append([]mounter.Event{}, events...)
+	}
+
+	BeforeEach(func() {
+		events = nil
+		supervisor = mounter.NewSupervisor()
+		supervisor.Interval = 10 * time.Millisecond
+		supervisor.Backoff.InitialInterval = 10 * time.Millisecond
+		supervisor.OnEvent = func(event mounter.Event) {
+			eventsMu.Lock()
+			defer eventsMu.Unlock()
+
+			events = append(events, event)
+		}
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		go supervisor.Run(ctx)
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should repair mounts that can't be probed", func() {
+		var repairs int32
+		supervisor.Watch("broken", []string{"/nonexistent/staging"}, func(ctx context.Context) error {
+			atomic.AddInt32(&repairs, 1)
+			return nil
+		})
+
+		Eventually(func() int32 { return atomic.LoadInt32(&repairs) }).Should(BeNumerically(">", 0))
+	})
+
+	It("should not repair healthy mounts", func() {
+		var repairs int32
+		supervisor.Watch("healthy", []string{os.TempDir()}, func(ctx context.Context) error {
+			atomic.AddInt32(&repairs, 1)
+			return nil
+		})
+
+		Consistently(func() int32 { return atomic.LoadInt32(&repairs) }, 100*time.Millisecond).Should(BeZero())
+	})
+
+	It("should stop supervising forgotten mounts", func() {
+		var repairs int32
+		supervisor.Watch("forgotten", []string{"/nonexistent/staging"}, func(ctx context.Context) error {
+			atomic.AddInt32(&repairs, 1)
+			return nil
+		})
+		supervisor.Forget("forgotten")
+
+		Consistently(func() int32 { return atomic.LoadInt32(&repairs) }, 100*time.Millisecond).Should(BeZero())
+	})
+
+	It("should report successful restarts", func() {
+		supervisor.Watch("restarted", []string{"/nonexistent/staging"}, func(ctx context.Context) error {
+			return nil
+		})
+
+		Eventually(recorded).ShouldNot(BeEmpty())
+		event := recorded()[0]
+		Expect(event.Key).To(Equal("restarted"))
+		Expect(event.Attempt).To(Equal(1))
+		Expect(event.Err).NotTo(HaveOccurred())
+	})
+
+	It("should report failed restarts with their attempt", func() {
+		supervisor.Watch("failing", []string{"/nonexistent/staging"}, func(ctx context.Context) error {
+			return errors.New("restage failed")
+		})
+
+		Eventually(func() int {
+			attempts := 0
+			for _, event := range recorded() {
+				Expect(event.Key).To(Equal("failing"))
+				Expect(event.Err).To(MatchError("restage failed"))
+				attempts = event.Attempt
+			}
+			return attempts
+		}).Should(BeNumerically(">=", 2))
+	})
+})
@@ -0,0 +1,124 @@
+package nativefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/minio/minio-go/v7"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+)
+
+const (
+	DefaultFileMode = 0o666
+	DefaultDirMode  = 0o777
+	BlockSize       = 4096
+	// Reported as size of the filesystem, if the volume has no capacity defined
+	DefaultCapacity = 1 << 50
+)
+
+// FileSystem serves the objects below a bucket prefix as FUSE filesystem from within the plugin process.
+type FileSystem struct {
+	Client *s3.S3Client
+	Bucket string
+	Prefix string
+	// Ownership and permissions reported for all files and directories
+	Uid      uint32
+	Gid      uint32
+	FileMode uint32
+	DirMode  uint32
+	// Directory of the temporary files holding the objects opened for writing, defaults to the temp dir of the OS
+	TempDir string
+	// Reported as size of the filesystem, which can be changed while it is served
+	capacity atomic.Int64
+}
+
+// SetCapacity changes the size reported for the filesystem, e.g. after the volume has been expanded.
+func (fsys *FileSystem) SetCapacity(capacityBytes int64) {
+	fsys.capacity.Store(capacityBytes)
+}
+
+// Capacity returns the size reported for the filesystem, or 0 if the volume has no capacity defined.
+func (fsys *FileSystem) Capacity() int64 {
+	return fsys.capacity.Load()
+}
+
+func New(client *s3.S3Client, bucket, prefix string) *FileSystem {
+	return &FileSystem{
+		Client:   client,
+		Bucket:   bucket,
+		Prefix:   prefix,
+		FileMode: DefaultFileMode,
+		DirMode:  DefaultDirMode,
+	}
+}
+
+// Root returns the node representing the prefix of the filesystem.
+func (f *FileSystem) Root() *Node {
+	return &Node{fsys: f}
+}
+
+// Mount serves the filesystem on path and returns once the kernel has accepted the mount.
+func (f *FileSystem) Mount(path string, options ...string) (*fuse.Server, error) {
+	server, err := fs.Mount(path, f.Root(), &fs.Options{
+		MountOptions: fuse.MountOptions{
+			AllowOther:  true,
+			FsName:      fmt.Sprintf("s3:%s", f.Bucket),
+			Name:        "nativefs",
+			DirectMount: true,
+			Options:     options,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to mount native filesystem on %s: %w", path, err)
+	}
+
+	return server, nil
+}
+
+// logFailure logs operations sent to the S3 backend that failed, except for missing objects, which are expected during lookups.
+func (f *FileSystem) logFailure(op, key string, err error) {
+	if err != nil && !isNotFound(err) {
+		log.Printf("native: %s of '%s/%s' failed: %v", op, f.Bucket, key, err)
+	}
+}
+
+func isNotFound(err error) bool {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket", "NotFound":
+		return true
+	}
+
+	return false
+}
+
+// toErrno maps errors returned by the S3 backend onto the closest errno.
+func toErrno(err error) syscall.Errno {
+	if err == nil {
+		return 0
+	}
+
+	if isNotFound(err) {
+		return syscall.ENOENT
+	}
+
+	if minio.ToErrorResponse(err).Code == "AccessDenied" {
+		return syscall.EACCES
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return syscall.EINTR
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno
+	}
+
+	return syscall.EIO
+}
@@ -0,0 +1,211 @@
+package nativefs
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/minio/minio-go/v7"
+)
+
+// handle serves reads directly from the object, while writes are buffered in a
+// temporary file, which is uploaded as a whole on flush.
+type handle struct {
+	node *Node
+
+	mu     sync.Mutex
+	object *minio.Object
+	file   *os.File
+	dirty  bool
+}
+
+var (
+	_ fs.FileReader   = (*handle)(nil)
+	_ fs.FileWriter   = (*handle)(nil)
+	_ fs.FileFlusher  = (*handle)(nil)
+	_ fs.FileFsyncer  = (*handle)(nil)
+	_ fs.FileReleaser = (*handle)(nil)
+)
+
+func newReadHandle(node *Node) *handle {
+	return &handle{
+		node: node,
+	}
+}
+
+func (n *Node) newWriteHandle() (*handle, syscall.Errno) {
+	file, err := os.CreateTemp(n.fsys.TempDir, "nativefs-*")
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	return &handle{
+		node: n,
+		file: file,
+	}, 0
+}
+
+// openWriteHandle creates a write handle that contains the current object, unless it is truncated.
+func (n *Node) openWriteHandle(ctx context.Context, truncate bool) (*handle, syscall.Errno) {
+	h, errno := n.newWriteHandle()
+	if errno != 0 {
+		return nil, errno
+	}
+
+	if truncate {
+		h.dirty = true
+		return h, 0
+	}
+
+	key := n.key()
+
+	object, err := n.fsys.Client.Minio.GetObject(ctx, n.fsys.Bucket, key, minio.GetObjectOptions{})
+	if err == nil {
+		_, err = io.Copy(h.file, object)
+		object.Close()
+	}
+	n.fsys.logFailure("open", key, err)
+
+	if err != nil && !isNotFound(err) {
+		h.Release(ctx)
+		return nil, toErrno(err)
+	}
+
+	return h, 0
+}
+
+func (h *handle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.file != nil {
+		read, err := h.file.ReadAt(dest, off)
+		if err != nil && err != io.EOF {
+			return nil, toErrno(err)
+		}
+
+		return fuse.ReadResultData(dest[:read]), 0
+	}
+
+	key := h.node.key()
+
+	if h.object == nil {
+		object, err := h.node.fsys.Client.Minio.GetObject(ctx, h.node.fsys.Bucket, key, minio.GetObjectOptions{})
+		if err != nil {
+			h.node.fsys.logFailure("read", key, err)
+			return nil, toErrno(err)
+		}
+
+		h.object = object
+	}
+
+	read, err := h.object.ReadAt(dest, off)
+	if err == io.EOF {
+		err = nil
+	}
+	h.node.fsys.logFailure("read", key, err)
+
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	return fuse.ReadResultData(dest[:read]), 0
+}
+
+func (h *handle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.file == nil {
+		return 0, syscall.EBADF
+	}
+
+	written, err := h.file.WriteAt(data, off)
+	if err != nil {
+		return uint32(written), toErrno(err)
+	}
+
+	h.dirty = true
+
+	return uint32(written), h.updateSize()
+}
+
+func (h *handle) truncate(size int64) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.file == nil {
+		return syscall.EBADF
+	}
+
+	if err := h.file.Truncate(size); err != nil {
+		return toErrno(err)
+	}
+
+	h.dirty = true
+
+	return h.updateSize()
+}
+
+func (h *handle) updateSize() syscall.Errno {
+	info, err := h.file.Stat()
+	if err != nil {
+		return toErrno(err)
+	}
+
+	h.node.setSize(info.Size())
+
+	return 0
+}
+
+func (h *handle) Flush(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.file == nil || !h.dirty {
+		return 0
+	}
+
+	info, err := h.file.Stat()
+	if err != nil {
+		return toErrno(err)
+	}
+
+	key := h.node.key()
+
+	_, err = h.node.fsys.Client.Minio.PutObject(ctx, h.node.fsys.Bucket, key, io.NewSectionReader(h.file, 0, info.Size()), info.Size(), minio.PutObjectOptions{})
+	h.node.fsys.logFailure("flush", key, err)
+	if err != nil {
+		return toErrno(err)
+	}
+
+	h.dirty = false
+
+	return 0
+}
+
+func (h *handle) Fsync(ctx context.Context, flags uint32) syscall.Errno {
+	return h.Flush(ctx)
+}
+
+func (h *handle) Release(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.object != nil {
+		h.object.Close()
+		h.object = nil
+	}
+
+	if h.file != nil {
+		h.file.Close()
+		os.Remove(h.file.Name())
+		h.file = nil
+	}
+
+	return 0
+}
@@ -0,0 +1,13 @@
+package nativefs
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestNativeFS(tst *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(tst, "NativeFS")
+}
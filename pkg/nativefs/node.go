@@ -0,0 +1,350 @@
+package nativefs
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/minio/minio-go/v7"
+)
+
+// Node represents a single object (file) or common prefix (directory).
+// The object key is derived from the position within the inode tree, so renames don't have to update nodes.
+type Node struct {
+	fs.Inode
+	fsys *FileSystem
+
+	mu    sync.Mutex
+	size  int64
+	mtime time.Time
+}
+
+var (
+	_ fs.NodeLookuper  = (*Node)(nil)
+	_ fs.NodeReaddirer = (*Node)(nil)
+	_ fs.NodeGetattrer = (*Node)(nil)
+	_ fs.NodeSetattrer = (*Node)(nil)
+	_ fs.NodeStatfser  = (*Node)(nil)
+	_ fs.NodeOpener    = (*Node)(nil)
+	_ fs.NodeCreater   = (*Node)(nil)
+	_ fs.NodeMkdirer   = (*Node)(nil)
+	_ fs.NodeUnlinker  = (*Node)(nil)
+	_ fs.NodeRmdirer   = (*Node)(nil)
+	_ fs.NodeRenamer   = (*Node)(nil)
+)
+
+func (n *Node) key() string {
+	return path.Join(n.fsys.Prefix, n.Path(nil))
+}
+
+func (n *Node) childKey(name string) string {
+	return path.Join(n.key(), name)
+}
+
+// dirPrefix returns the prefix used to list the content of a directory key.
+func dirPrefix(key string) string {
+	if key == "" || key == "." {
+		return ""
+	}
+
+	return key + "/"
+}
+
+func (n *Node) newChild(ctx context.Context, mode uint32, size int64, mtime time.Time) *fs.Inode {
+	child := &Node{
+		fsys:  n.fsys,
+		size:  size,
+		mtime: mtime,
+	}
+
+	return n.NewInode(ctx, child, fs.StableAttr{Mode: mode})
+}
+
+func (n *Node) fillAttr(out *fuse.Attr) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.IsDir() {
+		out.Mode = syscall.S_IFDIR | n.fsys.DirMode
+		out.Size = BlockSize
+	} else {
+		out.Mode = syscall.S_IFREG | n.fsys.FileMode
+		out.Size = uint64(n.size)
+	}
+
+	out.Owner = fuse.Owner{
+		Uid: n.fsys.Uid,
+		Gid: n.fsys.Gid,
+	}
+
+	out.Blksize = BlockSize
+	out.Blocks = (out.Size + 511) / 512
+	out.SetTimes(nil, &n.mtime, &n.mtime)
+}
+
+func (n *Node) setSize(size int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.size = size
+	n.mtime = time.Now()
+}
+
+func (n *Node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	key := n.childKey(name)
+
+	info, err := n.fsys.Client.Minio.StatObject(ctx, n.fsys.Bucket, key, minio.StatObjectOptions{})
+	n.fsys.logFailure("lookup", key, err)
+
+	if err == nil {
+		child := n.newChild(ctx, syscall.S_IFREG, info.Size, info.LastModified)
+		child.Operations().(*Node).fillAttr(&out.Attr)
+
+		return child, 0
+	}
+
+	if !isNotFound(err) {
+		return nil, toErrno(err)
+	}
+
+	// Directories only exist implicitly as common prefix of other objects
+	list, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range n.fsys.Client.Minio.ListObjects(list, n.fsys.Bucket, minio.ListObjectsOptions{
+		Prefix:  dirPrefix(key),
+		MaxKeys: 1,
+	}) {
+		n.fsys.logFailure("lookup", dirPrefix(key), object.Err)
+		if object.Err != nil {
+			return nil, toErrno(object.Err)
+		}
+
+		child := n.newChild(ctx, syscall.S_IFDIR, 0, object.LastModified)
+		child.Operations().(*Node).fillAttr(&out.Attr)
+
+		return child, 0
+	}
+
+	return nil, syscall.ENOENT
+}
+
+func (n *Node) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	prefix := dirPrefix(n.key())
+	entries := make([]fuse.DirEntry, 0)
+
+	for object := range n.fsys.Client.Minio.ListObjects(ctx, n.fsys.Bucket, minio.ListObjectsOptions{
+		Prefix: prefix,
+	}) {
+		if object.Err != nil {
+			n.fsys.logFailure("readdir", prefix, object.Err)
+			return nil, toErrno(object.Err)
+		}
+
+		name := strings.TrimPrefix(object.Key, prefix)
+		mode := uint32(syscall.S_IFREG)
+		if strings.HasSuffix(name, "/") {
+			name = strings.TrimSuffix(name, "/")
+			mode = syscall.S_IFDIR
+		}
+
+		// Skips the marker of the directory itself
+		if name == "" || strings.Contains(name, "/") {
+			continue
+		}
+
+		entries = append(entries, fuse.DirEntry{
+			Name: name,
+			Mode: mode,
+		})
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
+
+func (n *Node) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	n.fillAttr(&out.Attr)
+
+	return 0
+}
+
+func (n *Node) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	// Ownership and permissions can't be represented, so only truncation is applied
+	if size, ok := in.GetSize(); ok && !n.IsDir() {
+		h, ok := fh.(*handle)
+		if !ok {
+			opened, errno := n.openWriteHandle(ctx, size == 0)
+			if errno != 0 {
+				return errno
+			}
+
+			defer opened.Release(ctx)
+			h = opened
+		}
+
+		if errno := h.truncate(int64(size)); errno != 0 {
+			return errno
+		}
+
+		if errno := h.Flush(ctx); errno != 0 {
+			return errno
+		}
+	}
+
+	n.fillAttr(&out.Attr)
+
+	return 0
+}
+
+func (n *Node) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	capacity := n.fsys.Capacity()
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+
+	out.Bsize = BlockSize
+	out.Frsize = BlockSize
+	out.Blocks = uint64(capacity) / BlockSize
+	out.Bfree = out.Blocks
+	out.Bavail = out.Blocks
+	out.NameLen = 1024
+
+	return 0
+}
+
+func (n *Node) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) == 0 {
+		return newReadHandle(n), 0, 0
+	}
+
+	h, errno := n.openWriteHandle(ctx, flags&syscall.O_TRUNC != 0)
+	if errno != 0 {
+		return nil, 0, errno
+	}
+
+	return h, fuse.FOPEN_DIRECT_IO, 0
+}
+
+func (n *Node) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	child := n.newChild(ctx, syscall.S_IFREG, 0, time.Now())
+	node := child.Operations().(*Node)
+
+	h, errno := node.newWriteHandle()
+	if errno != 0 {
+		return nil, nil, 0, errno
+	}
+	// Ensures that the object is created, even if nothing is written
+	h.dirty = true
+
+	node.fillAttr(&out.Attr)
+
+	return child, h, fuse.FOPEN_DIRECT_IO, 0
+}
+
+func (n *Node) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	key := dirPrefix(n.childKey(name))
+
+	_, err := n.fsys.Client.Minio.PutObject(ctx, n.fsys.Bucket, key, bytes.NewReader([]byte{}), 0, minio.PutObjectOptions{})
+	n.fsys.logFailure("mkdir", key, err)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	child := n.newChild(ctx, syscall.S_IFDIR, 0, time.Now())
+	child.Operations().(*Node).fillAttr(&out.Attr)
+
+	return child, 0
+}
+
+func (n *Node) Unlink(ctx context.Context, name string) syscall.Errno {
+	key := n.childKey(name)
+
+	err := n.fsys.Client.Minio.RemoveObject(ctx, n.fsys.Bucket, key, minio.RemoveObjectOptions{})
+	n.fsys.logFailure("unlink", key, err)
+
+	return toErrno(err)
+}
+
+func (n *Node) Rmdir(ctx context.Context, name string) syscall.Errno {
+	prefix := dirPrefix(n.childKey(name))
+
+	list, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range n.fsys.Client.Minio.ListObjects(list, n.fsys.Bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			n.fsys.logFailure("rmdir", prefix, object.Err)
+			return toErrno(object.Err)
+		}
+
+		if object.Key != prefix {
+			return syscall.ENOTEMPTY
+		}
+	}
+
+	err := n.fsys.Client.Minio.RemoveObject(ctx, n.fsys.Bucket, prefix, minio.RemoveObjectOptions{})
+	n.fsys.logFailure("rmdir", prefix, err)
+
+	return toErrno(err)
+}
+
+func (n *Node) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	// RENAME_EXCHANGE and RENAME_NOREPLACE can't be implemented atomically on top of S3
+	if flags != 0 {
+		return syscall.ENOTSUP
+	}
+
+	src := n.childKey(name)
+	dst := newParent.EmbeddedInode().Operations().(*Node).childKey(newName)
+
+	if child := n.GetChild(name); child != nil && child.IsDir() {
+		return n.renameDir(ctx, dirPrefix(src), dirPrefix(dst))
+	}
+
+	return n.renameObject(ctx, src, dst)
+}
+
+func (n *Node) renameObject(ctx context.Context, src, dst string) syscall.Errno {
+	_, err := n.fsys.Client.Minio.ComposeObject(ctx, minio.CopyDestOptions{
+		Bucket: n.fsys.Bucket,
+		Object: dst,
+	}, minio.CopySrcOptions{
+		Bucket: n.fsys.Bucket,
+		Object: src,
+	})
+	n.fsys.logFailure("rename", src, err)
+	if err != nil {
+		return toErrno(err)
+	}
+
+	err = n.fsys.Client.Minio.RemoveObject(ctx, n.fsys.Bucket, src, minio.RemoveObjectOptions{})
+	n.fsys.logFailure("rename", src, err)
+
+	return toErrno(err)
+}
+
+func (n *Node) renameDir(ctx context.Context, src, dst string) syscall.Errno {
+	for object := range n.fsys.Client.Minio.ListObjects(ctx, n.fsys.Bucket, minio.ListObjectsOptions{
+		Prefix:    src,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return toErrno(object.Err)
+		}
+
+		if errno := n.renameObject(ctx, object.Key, dst+strings.TrimPrefix(object.Key, src)); errno != 0 {
+			return errno
+		}
+	}
+
+	return 0
+}
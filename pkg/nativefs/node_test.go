@@ -0,0 +1,192 @@
+package nativefs_test
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/nativefs"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3/s3test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func entryNames(stream fs.DirStream) map[string]uint32 {
+	names := make(map[string]uint32)
+	for stream.HasNext() {
+		entry, errno := stream.Next()
+		Expect(errno).To(Equal(syscall.Errno(0)))
+		names[entry.Name] = entry.Mode
+	}
+
+	return names
+}
+
+var _ = Describe("NativeFS", func() {
+	var (
+		ctx    context.Context
+		server *s3test.Server
+		fsys   *nativefs.FileSystem
+		root   *nativefs.Node
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		server = s3test.NewServer("bucket")
+
+		fsys = nativefs.New(server.Client(), "bucket", "volume")
+		root = fsys.Root()
+		// Attaches the root to an inode tree, which is otherwise done by mounting the filesystem
+		fs.NewNodeFS(root, &fs.Options{})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("Lookup", func() {
+		It("should return objects as files", func() {
+			server.Put("bucket", "volume/file", "content")
+
+			var out fuse.EntryOut
+			inode, errno := root.Lookup(ctx, "file", &out)
+			Expect(errno).To(Equal(syscall.Errno(0)))
+			Expect(inode.IsDir()).To(BeFalse())
+			Expect(out.Attr.Size).To(Equal(uint64(len("content"))))
+			Expect(out.Attr.Mode).To(Equal(uint32(syscall.S_IFREG | nativefs.DefaultFileMode)))
+		})
+
+		It("should return common prefixes as directories", func() {
+			server.Put("bucket", "volume/dir/file", "content")
+
+			var out fuse.EntryOut
+			inode, errno := root.Lookup(ctx, "dir", &out)
+			Expect(errno).To(Equal(syscall.Errno(0)))
+			Expect(inode.IsDir()).To(BeTrue())
+			Expect(out.Attr.Mode).To(Equal(uint32(syscall.S_IFDIR | nativefs.DefaultDirMode)))
+		})
+
+		It("should return ENOENT for neither objects nor common prefixes", func() {
+			server.Put("bucket", "volume/missing-file", "content")
+
+			var out fuse.EntryOut
+			_, errno := root.Lookup(ctx, "missing", &out)
+			Expect(errno).To(Equal(syscall.ENOENT))
+		})
+
+		It("should map denied requests onto EACCES", func() {
+			server.Deny("volume/secret")
+
+			var out fuse.EntryOut
+			_, errno := root.Lookup(ctx, "secret", &out)
+			Expect(errno).To(Equal(syscall.EACCES))
+		})
+	})
+
+	Context("Readdir", func() {
+		It("should list files and directories below the prefix only", func() {
+			server.Put("bucket", "volume/", "")
+			server.Put("bucket", "volume/file", "content")
+			server.Put("bucket", "volume/dir/file", "content")
+			server.Put("bucket", "other/file", "content")
+
+			stream, errno := root.Readdir(ctx)
+			Expect(errno).To(Equal(syscall.Errno(0)))
+			Expect(entryNames(stream)).To(Equal(map[string]uint32{
+				"file": syscall.S_IFREG,
+				"dir":  syscall.S_IFDIR,
+			}))
+		})
+	})
+
+	Context("Mkdir", func() {
+		It("should create a directory marker", func() {
+			var out fuse.EntryOut
+			inode, errno := root.Mkdir(ctx, "dir", 0o755, &out)
+			Expect(errno).To(Equal(syscall.Errno(0)))
+			Expect(inode.IsDir()).To(BeTrue())
+
+			_, ok := server.Get("bucket", "volume/dir/")
+			Expect(ok).To(BeTrue())
+		})
+	})
+
+	Context("Unlink", func() {
+		It("should remove the object", func() {
+			server.Put("bucket", "volume/file", "content")
+
+			Expect(root.Unlink(ctx, "file")).To(Equal(syscall.Errno(0)))
+
+			_, ok := server.Get("bucket", "volume/file")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("Rmdir", func() {
+		It("should refuse to remove directories that aren't empty", func() {
+			server.Put("bucket", "volume/dir/", "")
+			server.Put("bucket", "volume/dir/file", "content")
+
+			Expect(root.Rmdir(ctx, "dir")).To(Equal(syscall.ENOTEMPTY))
+
+			_, ok := server.Get("bucket", "volume/dir/")
+			Expect(ok).To(BeTrue())
+		})
+
+		It("should remove the marker of empty directories", func() {
+			server.Put("bucket", "volume/dir/", "")
+
+			Expect(root.Rmdir(ctx, "dir")).To(Equal(syscall.Errno(0)))
+
+			_, ok := server.Get("bucket", "volume/dir/")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("Create", func() {
+		It("should buffer written files within the temp dir until they're flushed", func() {
+			dir, err := os.MkdirTemp("", "nativefs-test-*")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			fsys.TempDir = dir
+
+			var out fuse.EntryOut
+			inode, fh, _, errno := root.Create(ctx, "file", syscall.O_WRONLY, 0o644, &out)
+			Expect(errno).To(Equal(syscall.Errno(0)))
+			// Attaches the file to its parent, which is otherwise done by the filesystem bridge
+			root.AddChild("file", inode, false)
+
+			_, errno = fh.(fs.FileWriter).Write(ctx, []byte("content"), 0)
+			Expect(errno).To(Equal(syscall.Errno(0)))
+			Expect(os.ReadDir(fsys.TempDir)).To(HaveLen(1))
+
+			Expect(fh.(fs.FileFlusher).Flush(ctx)).To(Equal(syscall.Errno(0)))
+			content, ok := server.Get("bucket", "volume/file")
+			Expect(ok).To(BeTrue())
+			Expect(content).To(Equal("content"))
+
+			Expect(fh.(fs.FileReleaser).Release(ctx)).To(Equal(syscall.Errno(0)))
+			Expect(os.ReadDir(fsys.TempDir)).To(BeEmpty())
+		})
+	})
+
+	Context("Statfs", func() {
+		It("should report the default capacity without a capacity", func() {
+			var out fuse.StatfsOut
+			Expect(root.Statfs(ctx, &out)).To(Equal(syscall.Errno(0)))
+			Expect(out.Blocks).To(Equal(uint64(nativefs.DefaultCapacity / nativefs.BlockSize)))
+		})
+
+		It("should report the capacity after it has been changed", func() {
+			fsys.SetCapacity(1 << 30)
+
+			var out fuse.StatfsOut
+			Expect(root.Statfs(ctx, &out)).To(Equal(syscall.Errno(0)))
+			Expect(out.Blocks).To(Equal(uint64(1<<30) / nativefs.BlockSize))
+			Expect(out.Bavail).To(Equal(out.Blocks))
+			Expect(fsys.Capacity()).To(Equal(int64(1 << 30)))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package node
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestNode(tst *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(tst, "Node")
+}
@@ -0,0 +1,74 @@
+package node
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+)
+
+// EnforceQuotas periodically compares the usage of all volumes using a node quota with their capacity,
+// until the context is cancelled.
+func (n *Nodeserver) EnforceQuotas(ctx context.Context) {
+	ticker := time.NewTicker(n.Usage.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.enforceQuotas(ctx)
+		}
+	}
+}
+
+func (n *Nodeserver) enforceQuotas(ctx context.Context) {
+	changed := false
+
+	n.Volumes.Range(func(key, value interface{}) bool {
+		volume := value.(*Volume)
+		if volume.Meta.Quota != s3.QuotaNode || volume.Capacity() <= 0 {
+			return true
+		}
+
+		usage := n.Usage.Get(volume)
+		// Unknown usages are reported by the volume condition instead
+		if usage.Unknown || usage.Err != nil {
+			return true
+		}
+
+		mutex := n.GetVolumeMutex(volume.VolumeId)
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		// The volume may have been unstaged in the meantime
+		if current, ok := n.Volumes.Load(key); !ok || current != volume {
+			return true
+		}
+
+		exceeded := usage.UsedBytes > volume.Capacity()
+		if exceeded == volume.IsQuotaExceeded() {
+			return true
+		}
+
+		if err := volume.EnforceQuota(exceeded); err != nil {
+			log.Printf("Unable to enforce quota of volume %s: %v", volume.VolumeId, err)
+			return true
+		}
+
+		if exceeded {
+			log.Printf("volume %s exceeds its capacity with %d of %d bytes, remounted read-only", volume.VolumeId, usage.UsedBytes, volume.Capacity())
+		} else {
+			log.Printf("volume %s is within its capacity again with %d of %d bytes, restored access", volume.VolumeId, usage.UsedBytes, volume.Capacity())
+		}
+
+		changed = true
+		return true
+	})
+
+	if changed {
+		n.SaveState()
+	}
+}
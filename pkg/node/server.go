@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"path"
 	"sync"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	csicommon "github.com/kubernetes-csi/drivers/pkg/csi-common"
@@ -20,10 +22,15 @@ import (
 type Nodeserver struct {
 	*csicommon.DefaultNodeServer
 	Cfg        *config.DriverConfig
+	State      *StateFile
+	Supervisor *mounter.Supervisor
+	Usage      *UsageCache
 	Volumes    sync.Map
 	Mutexes    *common.KeyMutex
 	Verifiers  map[string]*mount.MountVerifier
 	VerifierMu sync.Mutex
+	// Serializes SaveState, so that the state of all volumes is collected and written at once
+	stateMu sync.Mutex
 }
 
 func (n *Nodeserver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
@@ -43,13 +50,25 @@ func (n *Nodeserver) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 		return nil, status.Error(codes.InvalidArgument, "Target path missing in request")
 	}
 
-	isMountable, err := mount.CheckMount(req.GetTargetPath())
-	if err != nil {
-		return nil, err
-	}
-
-	if !isMountable {
-		return &csi.NodePublishVolumeResponse{}, nil
+	// Block volumes are published as file, so the target can't be prepared as directory
+	if req.GetVolumeCapability().GetBlock() != nil {
+		isMounted, err := mount.IsBindMounted(req.GetTargetPath())
+		if err != nil {
+			return nil, err
+		}
+
+		if isMounted {
+			return &csi.NodePublishVolumeResponse{}, nil
+		}
+	} else {
+		isMountable, err := mount.CheckMount(req.GetTargetPath())
+		if err != nil {
+			return nil, err
+		}
+
+		if !isMountable {
+			return &csi.NodePublishVolumeResponse{}, nil
+		}
 	}
 
 	deviceID := ""
@@ -64,15 +83,17 @@ func (n *Nodeserver) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	volume, ok := n.Volumes.Load(req.GetVolumeId())
+	volume, ok := n.Volumes.Load(VolumeKey(req.GetVolumeId(), req.GetStagingTargetPath()))
 	if !ok {
-		return nil, err
+		return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("volume %s hasn't been staged yet", req.GetVolumeId()))
 	}
+	n.refreshSecrets(ctx, volume.(*Volume), req.GetSecrets())
 
-	if err := volume.(*Volume).Publish(ctx, req.GetTargetPath()); err != nil {
+	if err := volume.(*Volume).Publish(ctx, req.GetTargetPath(), req.GetVolumeCapability(), req.GetReadonly()); err != nil {
 		return nil, err
 	}
 
+	n.SaveState()
 	log.Printf("volume %s successfuly mounted to %s", req.GetVolumeId(), req.GetTargetPath())
 
 	return &csi.NodePublishVolumeResponse{}, nil
@@ -92,17 +113,18 @@ func (n *Nodeserver) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpub
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	volume, ok := n.Volumes.Load(req.GetVolumeId())
-	if !ok {
+	volume := n.FindPublishedVolume(req.GetVolumeId(), req.GetTargetPath())
+	if volume == nil {
 		log.Printf("volume %s hasn't been published yet", req.GetVolumeId())
 
 		return &csi.NodeUnpublishVolumeResponse{}, nil
 	}
 
-	if err := volume.(*Volume).Unpublish(ctx, req.GetTargetPath()); err != nil {
+	if err := volume.Unpublish(ctx, req.GetTargetPath()); err != nil {
 		return nil, err
 	}
 
+	n.SaveState()
 	log.Printf("volume %s has been unpublished from %s", req.GetVolumeId(), req.GetTargetPath())
 
 	return &csi.NodeUnpublishVolumeResponse{}, nil
@@ -129,15 +151,16 @@ func (n *Nodeserver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolu
 	mutex.Lock()
 	defer mutex.Unlock()
 
+	if volume, ok := n.Volumes.Load(VolumeKey(volumeid, stagingpath)); ok && volume.(*Volume).IsStaged() {
+		n.refreshSecrets(ctx, volume.(*Volume), req.GetSecrets())
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+
 	isMountable, err := mount.CheckMount(stagingpath)
 	if err != nil {
 		return nil, err
 	}
 
-	if !isMountable {
-		return &csi.NodeStageVolumeResponse{}, nil
-	}
-
 	minio, err := s3.CreateClient(n.Cfg, req.GetSecrets())
 	if err != nil {
 		return nil, err
@@ -146,21 +169,64 @@ func (n *Nodeserver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolu
 	bucketName, prefix := common.VolumeIDToBucketPrefix(volumeid)
 	meta, err := minio.GetFSMeta(ctx, bucketName, prefix)
 	if err != nil {
-		return nil, err
+		if exists, err := minio.BucketExists(ctx, bucketName); err == nil && !exists {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("bucket %s of volume %s doesn't exist", bucketName, volumeid))
+		}
+
+		return nil, fmt.Errorf("failed to read metadata of volume %s: %w", volumeid, err)
 	}
 
-	mounter, err := mounter.NewMounter(meta, minio.Config)
+	cfg, err := volumeConfig(ctx, minio, meta)
 	if err != nil {
 		return nil, err
 	}
 
-	volume := NewVolume(volumeid, mounter)
+	mounterType := mounter.GetMounterType(meta, cfg)
+	if !mounter.GetCapabilities(mounterType).Supports(req.GetVolumeCapability()) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volume capability is not supported by mounter '%s'", mounterType))
+	}
+
+	if _, err := mounter.TranslateMountOptions(mounterType, req.GetVolumeCapability().GetMount().GetMountFlags()...); err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid mount flags: %v", err))
+	}
+
+	if len(meta.ClientEncryption) > 0 {
+		if req.GetVolumeCapability().GetBlock() != nil {
+			return nil, status.Error(codes.InvalidArgument, "Block volumes don't support client encryption")
+		}
+
+		if len(req.GetSecrets()["clientEncryptionKey"]) <= 0 {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volume %s requires the secret clientEncryptionKey", volumeid))
+		}
+	}
+
+	mounter, err := mounter.NewMounter(meta, cfg)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	volume := NewVolume(volumeid, meta, cfg, mounter)
+	volume.alias = req.GetSecrets()["alias"]
+	volume.clientKey = req.GetSecrets()["clientEncryptionKey"]
 
-	if err := volume.Stage(ctx, stagingpath); err != nil {
+	// The staging path has already been mounted by a previous instance of the plugin, which wasn't persisted
+	if !isMountable {
+		volume.Adopt(stagingpath, req.GetVolumeCapability())
+		n.Volumes.Store(VolumeKey(volumeid, stagingpath), volume)
+		n.SaveState()
+		n.Supervise(volume)
+
+		log.Printf("volume %s re-adopted at %s", volumeid, stagingpath)
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+
+	if err := volume.Stage(ctx, stagingpath, req.GetVolumeCapability()); err != nil {
 		return nil, err
 	}
 
-	n.Volumes.Store(volumeid, volume)
+	n.Volumes.Store(VolumeKey(volumeid, stagingpath), volume)
+	n.SaveState()
+	n.Supervise(volume)
 	log.Printf("volume %s successfully staged to %s", volumeid, stagingpath)
 
 	return &csi.NodeStageVolumeResponse{}, nil
@@ -183,7 +249,7 @@ func (n *Nodeserver) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstage
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	volume, ok := n.Volumes.Load(volumeid)
+	volume, ok := n.Volumes.Load(VolumeKey(volumeid, stagingpath))
 	if !ok {
 		log.Printf("volume %s hasn't been staged yet", volumeid)
 
@@ -194,29 +260,314 @@ func (n *Nodeserver) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstage
 		return nil, err
 	}
 
-	n.Volumes.Delete(volumeid)
+	n.Volumes.Delete(VolumeKey(volumeid, stagingpath))
+	n.SaveState()
+	if n.Supervisor != nil {
+		n.Supervisor.Forget(VolumeKey(volumeid, stagingpath))
+	}
+	if n.Usage != nil {
+		n.Usage.Forget(volumeid)
+	}
 
 	return &csi.NodeUnstageVolumeResponse{}, nil
 }
 
-func (n *Nodeserver) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
-	nscap := &csi.NodeServiceCapability{
-		Type: &csi.NodeServiceCapability_Rpc{
-			Rpc: &csi.NodeServiceCapability_RPC{
-				Type: csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+func (n *Nodeserver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
+	if len(req.GetVolumeId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "VolumeID missing in request")
+	}
+
+	if len(req.GetVolumePath()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume path missing in request")
+	}
+
+	mutex := n.GetVolumeMutex(req.GetVolumeId())
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	volume := n.FindVolume(req.GetVolumeId(), req.GetVolumePath())
+	if volume == nil {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("volume %s isn't staged or published to %s", req.GetVolumeId(), req.GetVolumePath()))
+	}
+
+	usage := n.Usage.Get(volume)
+
+	// Until the usage has been calculated, only the capacity of the volume is known
+	if usage.Unknown {
+		return &csi.NodeGetVolumeStatsResponse{
+			Usage: []*csi.VolumeUsage{
+				{
+					Unit:  csi.VolumeUsage_BYTES,
+					Total: volume.Capacity(),
+				},
+			},
+			VolumeCondition: n.GetVolumeCondition(volume, usage),
+		}, nil
+	}
+
+	bytes := &csi.VolumeUsage{
+		Unit: csi.VolumeUsage_BYTES,
+		Used: usage.UsedBytes,
+	}
+	if capacity := volume.Capacity(); capacity > 0 {
+		bytes.Total = capacity
+		bytes.Available = capacity - usage.UsedBytes
+		if bytes.Available < 0 {
+			bytes.Available = 0
+		}
+	}
+
+	return &csi.NodeGetVolumeStatsResponse{
+		Usage: []*csi.VolumeUsage{
+			bytes,
+			{
+				Unit: csi.VolumeUsage_INODES,
+				Used: usage.Objects,
 			},
 		},
+		VolumeCondition: n.GetVolumeCondition(volume, usage),
+	}, nil
+}
+
+// GetVolumeCondition reports the volume as abnormal, if its mount is dead or the backend can't be reached.
+func (n *Nodeserver) GetVolumeCondition(volume *Volume, usage *Usage) *csi.VolumeCondition {
+	restart := volume.lastRestart()
+	if restart != nil && restart.Err != nil {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Mount of volume couldn't be restarted (attempt %d at %s): %v", restart.Attempt, restart.Time.Format(time.RFC3339), restart.Err),
+		}
+	}
+
+	for _, path := range volume.SupervisedPaths() {
+		if err := mounter.ProbeMount(path, mounter.DefaultProbeTimeout, nil); err != nil {
+			return &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  fmt.Sprintf("Mount of volume is unhealthy: %v", err),
+			}
+		}
+	}
+
+	// The mounts can't be repaired, so the volume has to be staged again with its secrets
+	if err := volume.missingSecrets(); err != nil {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Volume can't be repaired: %v", err),
+		}
+	}
+
+	if volume.IsQuotaExceeded() {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Usage of %d bytes exceeds the capacity of %d bytes, volume has been remounted read-only", usage.UsedBytes, volume.Capacity()),
+		}
+	}
+
+	if usage.Err != nil {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("S3 backend is unreachable: %v", usage.Err),
+		}
+	}
+
+	message := "Volume is healthy"
+	if restart != nil {
+		message += fmt.Sprintf(", its mount has been restarted at %s", restart.Time.Format(time.RFC3339))
+	}
+	if usage.Unknown {
+		message += ", its usage is still being calculated"
+	}
+
+	return &csi.VolumeCondition{
+		Abnormal: false,
+		Message:  message,
+	}
+}
+
+// RecordRestart keeps the latest restart of a supervised mount, so that it is reported by the condition of its volume.
+func (n *Nodeserver) RecordRestart(event mounter.Event) {
+	if volume, ok := n.Volumes.Load(event.Key); ok {
+		volume.(*Volume).setRestart(event)
+	}
+}
+
+func (n *Nodeserver) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
+	capabilities := make([]*csi.NodeServiceCapability, 0)
+	for _, rpc := range []csi.NodeServiceCapability_RPC_Type{
+		csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+		csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+		csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+		csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+	} {
+		capabilities = append(capabilities, &csi.NodeServiceCapability{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{
+					Type: rpc,
+				},
+			},
+		})
 	}
 
 	return &csi.NodeGetCapabilitiesResponse{
-		Capabilities: []*csi.NodeServiceCapability{
-			nscap,
-		},
+		Capabilities: capabilities,
 	}, nil
 }
 
 func (n *Nodeserver) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
-	return &csi.NodeExpandVolumeResponse{}, status.Error(codes.Unimplemented, fmt.Sprintf("%s is not implemented", "NodeExpandVolume"))
+	volumeid := req.GetVolumeId()
+
+	if len(volumeid) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "VolumeID missing in request")
+	}
+
+	if len(req.GetVolumePath()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume path missing in request")
+	}
+
+	mutex := n.GetVolumeMutex(volumeid)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	volume := n.FindVolume(volumeid, req.GetVolumePath())
+	if volume == nil {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("volume %s isn't staged or published to %s", volumeid, req.GetVolumePath()))
+	}
+
+	// The capacity is only part of the metadata, so the mounts can be kept as is
+	capacityBytes := req.GetCapacityRange().GetRequiredBytes()
+	if client, err := s3.CreateClientFromConfig(volume.config()); err == nil {
+		if meta, err := client.GetFSMeta(ctx, volume.Meta.BucketName, volume.Meta.Prefix); err == nil && meta.CapacityBytes > capacityBytes {
+			capacityBytes = meta.CapacityBytes
+		}
+	}
+
+	if capacityBytes <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "Capacity of volume is unknown")
+	}
+
+	// Updates every staging of the volume on this node
+	n.Volumes.Range(func(key, value interface{}) bool {
+		if v := value.(*Volume); v.VolumeId == volumeid && v.Expand(capacityBytes) {
+			log.Printf("Expanded volume %s at %s to %d bytes", volumeid, v.stagingTargetPath, capacityBytes)
+		}
+
+		return true
+	})
+	n.SaveState()
+
+	return &csi.NodeExpandVolumeResponse{
+		CapacityBytes: capacityBytes,
+	}, nil
+}
+
+// volumeConfig returns the config the volume is mounted with.
+// Volumes with scoped credentials are mounted with the credentials of their own service account.
+func volumeConfig(ctx context.Context, client *s3.S3Client, meta *s3.FSMeta) (*s3.S3Config, error) {
+	cfg := client.Config
+	if meta.ScopedCredentials {
+		creds, err := client.GetVolumeCredentials(ctx, meta.BucketName, meta.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read credentials of volume %s: %w", path.Join(meta.BucketName, meta.Prefix), err)
+		}
+
+		cfg = cfg.WithCredentials(creds)
+	}
+
+	return cfg, nil
+}
+
+// restoreSecrets restores the credentials of a volume, which aren't persisted within the state, from the secrets.
+func (n *Nodeserver) restoreSecrets(ctx context.Context, volume *Volume, secrets map[string]string) error {
+	client, err := s3.CreateClient(n.Cfg, secrets)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := volumeConfig(ctx, client, volume.Meta)
+	if err != nil {
+		return err
+	}
+
+	volume.setSecrets(cfg, secrets)
+	return nil
+}
+
+// refreshSecrets restores the credentials of a volume re-adopted after a restart from the secrets of a request,
+// which allows the volume to be supervised again.
+func (n *Nodeserver) refreshSecrets(ctx context.Context, volume *Volume, secrets map[string]string) {
+	if volume.missingSecrets() == nil || len(secrets) <= 0 {
+		return
+	}
+
+	if err := n.restoreSecrets(ctx, volume, secrets); err != nil {
+		log.Printf("Unable to restore credentials of volume %s: %v", volume.VolumeId, err)
+		return
+	}
+
+	n.SaveState()
+	n.Supervise(volume)
+	log.Printf("credentials of volume %s have been restored", volume.VolumeId)
+}
+
+// Supervise watches the mounts of a staged volume and repairs them, if its fuse process crashes or hangs.
+// Volumes whose credentials are unknown can't be staged again, so they are only reported as abnormal.
+func (n *Nodeserver) Supervise(volume *Volume) {
+	if n.Supervisor == nil {
+		return
+	}
+
+	if err := volume.missingSecrets(); err != nil {
+		log.Printf("Not supervising volume %s: %v", volume.VolumeId, err)
+		return
+	}
+
+	key := VolumeKey(volume.VolumeId, volume.stagingTargetPath)
+	n.Supervisor.Watch(key, volume.SupervisedPaths(), func(ctx context.Context) error {
+		mutex := n.GetVolumeMutex(volume.VolumeId)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		// The volume may have been unstaged in the meantime
+		if current, ok := n.Volumes.Load(key); !ok || current.(*Volume) != volume {
+			return nil
+		}
+
+		return volume.Repair(ctx)
+	})
+}
+
+// FindVolume returns the volume, which has been staged or published to path.
+func (n *Nodeserver) FindVolume(volumeID, path string) *Volume {
+	if volume, ok := n.Volumes.Load(VolumeKey(volumeID, path)); ok {
+		return volume.(*Volume)
+	}
+
+	return n.FindPublishedVolume(volumeID, path)
+}
+
+// FindPublishedVolume returns the staged volume, which has been published to the target path.
+func (n *Nodeserver) FindPublishedVolume(volumeID, targetPath string) *Volume {
+	var found *Volume
+	n.Volumes.Range(func(key, value interface{}) bool {
+		volume := value.(*Volume)
+		if volume.VolumeId == volumeID && volume.IsPublished(targetPath) {
+			found = volume
+			return false
+		}
+
+		return true
+	})
+
+	return found
+}
+
+// VolumeKey identifies a staged volume, as the same volume can be staged multiple times
+// on a node with different capabilities (e.g. read-only and read-write).
+func VolumeKey(volumeID, stagingPath string) string {
+	return volumeID + ":" + stagingPath
 }
 
 func (n *Nodeserver) GetVolumeMutex(volumeID string) *sync.RWMutex {
@@ -0,0 +1,117 @@
+package node_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/mounter"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/node"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func newVolume(stagingPath string) *node.Volume {
+	meta := &s3.FSMeta{BucketName: "bucket", FSPath: "fs", CapacityBytes: 1 << 20}
+	cfg := &s3.S3Config{AccessKeyID: "access", SecretAccessKey: "secret"}
+
+	m, err := mounter.NewS3FSMounter(meta, cfg)
+	Expect(err).NotTo(HaveOccurred())
+
+	vol := node.NewVolume("bucket", meta, cfg, m)
+	vol.Adopt(stagingPath, &csi.VolumeCapability{})
+
+	return vol
+}
+
+var _ = Describe("GetVolumeCondition", func() {
+	var (
+		ns  *node.Nodeserver
+		vol *node.Volume
+	)
+
+	BeforeEach(func() {
+		ns = &node.Nodeserver{}
+		vol = newVolume(os.TempDir())
+		ns.Volumes.Store(node.VolumeKey(vol.VolumeId, os.TempDir()), vol)
+	})
+
+	It("should report a healthy volume", func() {
+		condition := ns.GetVolumeCondition(vol, &node.Usage{})
+		Expect(condition.Abnormal).To(BeFalse())
+		Expect(condition.Message).To(Equal("Volume is healthy"))
+	})
+
+	It("should report a volume with an unknown usage as healthy", func() {
+		condition := ns.GetVolumeCondition(vol, &node.Usage{Unknown: true})
+		Expect(condition.Abnormal).To(BeFalse())
+		Expect(condition.Message).To(ContainSubstring("usage is still being calculated"))
+	})
+
+	It("should report an unreachable backend", func() {
+		condition := ns.GetVolumeCondition(vol, &node.Usage{Err: errors.New("connection refused")})
+		Expect(condition.Abnormal).To(BeTrue())
+		Expect(condition.Message).To(ContainSubstring("connection refused"))
+	})
+
+	It("should report a mount that can't be probed", func() {
+		broken := newVolume("/nonexistent/staging")
+
+		condition := ns.GetVolumeCondition(broken, &node.Usage{})
+		Expect(condition.Abnormal).To(BeTrue())
+		Expect(condition.Message).To(ContainSubstring("Mount of volume is unhealthy"))
+	})
+
+	It("should report a volume without credentials", func() {
+		vol.Cfg.AccessKeyID = ""
+
+		condition := ns.GetVolumeCondition(vol, &node.Usage{})
+		Expect(condition.Abnormal).To(BeTrue())
+		Expect(condition.Message).To(ContainSubstring("can't be repaired"))
+	})
+
+	It("should report a failed restart of the mount", func() {
+		ns.RecordRestart(mounter.Event{
+			Key:     node.VolumeKey(vol.VolumeId, os.TempDir()),
+			Attempt: 3,
+			Time:    time.Now(),
+			Err:     errors.New("restage failed"),
+		})
+
+		condition := ns.GetVolumeCondition(vol, &node.Usage{})
+		Expect(condition.Abnormal).To(BeTrue())
+		Expect(condition.Message).To(ContainSubstring("attempt 3"))
+		Expect(condition.Message).To(ContainSubstring("restage failed"))
+	})
+
+	It("should report a successful restart of the mount as healthy", func() {
+		key := node.VolumeKey(vol.VolumeId, os.TempDir())
+		ns.RecordRestart(mounter.Event{Key: key, Attempt: 1, Time: time.Now(), Err: errors.New("restage failed")})
+		ns.RecordRestart(mounter.Event{Key: key, Attempt: 2, Time: time.Now()})
+
+		condition := ns.GetVolumeCondition(vol, &node.Usage{})
+		Expect(condition.Abnormal).To(BeFalse())
+		Expect(condition.Message).To(ContainSubstring("mount has been restarted"))
+	})
+
+	It("should ignore restarts of unknown volumes", func() {
+		ns.RecordRestart(mounter.Event{Key: "unknown", Time: time.Now(), Err: errors.New("restage failed")})
+
+		condition := ns.GetVolumeCondition(vol, &node.Usage{})
+		Expect(condition.Abnormal).To(BeFalse())
+	})
+})
+
+var _ = Describe("Volume", func() {
+	It("should only expand volumes to a larger capacity", func() {
+		vol := newVolume(os.TempDir())
+
+		Expect(vol.Expand(1 << 10)).To(BeFalse())
+		Expect(vol.Capacity()).To(Equal(int64(1 << 20)))
+
+		Expect(vol.Expand(1 << 30)).To(BeTrue())
+		Expect(vol.Capacity()).To(Equal(int64(1 << 30)))
+	})
+})
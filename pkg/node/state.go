@@ -0,0 +1,258 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/proto"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common/mount"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/mounter"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+)
+
+// VolumeState is the persisted state of a staged volume.
+type VolumeState struct {
+	VolumeId          string     `json:"volumeid"`
+	StagingTargetPath string     `json:"stagingtargetpath"`
+	Capability        []byte     `json:"capability"`
+	Meta              *s3.FSMeta `json:"meta"`
+	// Config of the volume without its credentials, which are requested again from the alias or the next request
+	Config *s3.S3Config `json:"config"`
+	Alias  string       `json:"alias,omitempty"`
+	// Target paths and whether they have been published read-only
+	TargetPaths map[string]bool `json:"targetpaths"`
+	// Set if the targets have been remounted read-only by the node quota
+	QuotaExceeded bool `json:"quotaexceeded,omitempty"`
+}
+
+// StateFile persists the staged and published volumes of the node, so that they can be re-adopted after a restart.
+// Credentials of volumes are never persisted, but the file is still only readable by the plugin.
+type StateFile struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func NewStateFile(path string) *StateFile {
+	return &StateFile{
+		Path: path,
+	}
+}
+
+func (s *StateFile) Load() ([]*VolumeState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var states []*VolumeState
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	return states, nil
+}
+
+func (s *StateFile) Save(states []*VolumeState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(states)
+	if err != nil {
+		return fmt.Errorf("failed to serialize state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o750); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	// Writes to a temporary file first, so that the state is never left partially written
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	if err := os.Rename(tmp, s.Path); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	return nil
+}
+
+func (vol *Volume) State() (*VolumeState, error) {
+	vol.mu.Lock()
+	defer vol.mu.Unlock()
+
+	capability, err := proto.Marshal(vol.capability)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize capability of volume %s: %w", vol.VolumeId, err)
+	}
+
+	targets := make(map[string]bool, len(vol.targetPaths))
+	for target, readonly := range vol.targetPaths {
+		targets[target] = readonly
+	}
+
+	meta := *vol.Meta
+	cfg := *vol.Cfg
+	cfg.AccessKeyID = ""
+	cfg.SecretAccessKey = ""
+
+	return &VolumeState{
+		VolumeId:          vol.VolumeId,
+		StagingTargetPath: vol.stagingTargetPath,
+		Capability:        capability,
+		Meta:              &meta,
+		Config:            &cfg,
+		Alias:             vol.alias,
+		TargetPaths:       targets,
+		QuotaExceeded:     vol.quotaExceeded,
+	}, nil
+}
+
+// SaveState persists all staged volumes, errors are only logged as they must not fail the request itself.
+func (n *Nodeserver) SaveState() {
+	if n.State == nil {
+		return
+	}
+
+	// Collecting and writing the state at once prevents an older state from being written last
+	n.stateMu.Lock()
+	defer n.stateMu.Unlock()
+
+	states := make([]*VolumeState, 0)
+	n.Volumes.Range(func(key, value interface{}) bool {
+		volume := value.(*Volume)
+		if !volume.IsStaged() {
+			return true
+		}
+
+		state, err := volume.State()
+		if err != nil {
+			log.Printf("Unable to persist volume %s: %v", volume.VolumeId, err)
+			return true
+		}
+
+		states = append(states, state)
+		return true
+	})
+
+	if err := n.State.Save(states); err != nil {
+		log.Printf("Unable to persist node state: %v", err)
+	}
+}
+
+// RestoreState loads the persisted volumes and reconciles them against the mount table.
+// Mounts that are still alive are re-adopted, while missing or dead mounts are staged and published again.
+func (n *Nodeserver) RestoreState(ctx context.Context) error {
+	if n.State == nil {
+		return nil
+	}
+
+	states, err := n.State.Load()
+	if err != nil {
+		return err
+	}
+
+	mounts, err := mount.ListMountPoints()
+	if err != nil {
+		return err
+	}
+
+	for _, state := range states {
+		volume, err := n.restoreVolume(ctx, state, mounts)
+		if err != nil {
+			log.Printf("Unable to restore volume %s staged to %s: %v", state.VolumeId, state.StagingTargetPath, err)
+			continue
+		}
+
+		n.Volumes.Store(VolumeKey(state.VolumeId, state.StagingTargetPath), volume)
+		n.Supervise(volume)
+	}
+
+	n.SaveState()
+	return nil
+}
+
+func (n *Nodeserver) restoreVolume(ctx context.Context, state *VolumeState, mounts map[string]bool) (*Volume, error) {
+	capability := &csi.VolumeCapability{}
+	if err := proto.Unmarshal(state.Capability, capability); err != nil {
+		return nil, fmt.Errorf("failed to parse capability: %w", err)
+	}
+
+	m, err := mounter.NewMounter(state.Meta, state.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	volume := NewVolume(state.VolumeId, state.Meta, state.Config, m)
+	volume.quotaExceeded = state.QuotaExceeded
+
+	// Volumes staged through an alias get their credentials from the config again,
+	// all others can only be staged again once the secrets are part of another request
+	if len(state.Alias) > 0 {
+		if err := n.restoreSecrets(ctx, volume, map[string]string{"alias": state.Alias}); err != nil {
+			log.Printf("Unable to restore credentials of volume %s: %v", state.VolumeId, err)
+		}
+	}
+
+	restaged := !mount.IsHealthyMount(state.StagingTargetPath, mounts)
+	if !restaged {
+		volume.Adopt(state.StagingTargetPath, capability)
+		log.Printf("volume %s re-adopted at %s", state.VolumeId, state.StagingTargetPath)
+	} else {
+		// The fuse process is gone, so all targets have to be published again
+		log.Printf("volume %s isn't mounted at %s anymore, staging again", state.VolumeId, state.StagingTargetPath)
+
+		for target := range state.TargetPaths {
+			if err := mount.CleanupMountPoint(target); err != nil {
+				log.Printf("Unable to clean up target %s: %v", target, err)
+			}
+		}
+
+		if err := volume.unstage(ctx, state.StagingTargetPath); err != nil {
+			log.Printf("Unable to clean up staging path %s: %v", state.StagingTargetPath, err)
+		}
+
+		if _, err := mount.CheckMount(state.StagingTargetPath); err != nil {
+			return nil, err
+		}
+
+		if err := volume.Stage(ctx, state.StagingTargetPath, capability); err != nil {
+			return nil, err
+		}
+	}
+
+	for target, readonly := range state.TargetPaths {
+		if !restaged {
+			if mount.IsHealthyMount(target, mounts) {
+				volume.targetPaths[target] = readonly
+				continue
+			}
+
+			if err := mount.CleanupMountPoint(target); err != nil {
+				log.Printf("Unable to clean up target %s: %v", target, err)
+			}
+		}
+
+		if err := volume.Publish(ctx, target, capability, readonly); err != nil {
+			log.Printf("Unable to publish volume %s to %s again: %v", state.VolumeId, target, err)
+			continue
+		}
+
+		log.Printf("volume %s published to %s again", state.VolumeId, target)
+	}
+
+	return volume, nil
+}
@@ -0,0 +1,118 @@
+package node
+
+import (
+	"context"
+	"log"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+)
+
+const (
+	DefaultUsageInterval = time.Minute
+	DefaultUsageTimeout  = 5 * time.Minute
+)
+
+// Usage is the last known usage of a volume within its bucket or prefix.
+type Usage struct {
+	UsedBytes int64
+	Objects   int64
+	Updated   time.Time
+	// Set until the usage of the volume has been calculated for the first time
+	Unknown bool
+	// Set if the usage couldn't be refreshed, e.g. because the backend is unreachable
+	Err error
+}
+
+// UsageCache keeps the usage of each volume, which is refreshed in the background,
+// as listing all objects of a large bucket is too expensive to be done on every request.
+type UsageCache struct {
+	Interval time.Duration
+	Timeout  time.Duration
+
+	mu     sync.Mutex
+	usages map[string]*Usage
+	// Generation of the refresh in progress for each volume, so that refreshes of forgotten volumes are discarded
+	refreshing map[string]uint64
+	generation uint64
+}
+
+func NewUsageCache() *UsageCache {
+	return &UsageCache{
+		Interval:   DefaultUsageInterval,
+		Timeout:    DefaultUsageTimeout,
+		usages:     make(map[string]*Usage),
+		refreshing: make(map[string]uint64),
+	}
+}
+
+// Get returns the cached usage of the volume, which is never calculated synchronously, as listing a large bucket
+// would block the request. Missing or outdated usages start a refresh in the background, while an unknown usage
+// is returned until the first refresh has been completed.
+func (c *UsageCache) Get(vol *Volume) *Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	usage, ok := c.usages[vol.VolumeId]
+	if !ok || time.Since(usage.Updated) > c.Interval {
+		if _, refreshing := c.refreshing[vol.VolumeId]; !refreshing {
+			c.generation++
+			c.refreshing[vol.VolumeId] = c.generation
+
+			go c.refresh(vol, c.generation)
+		}
+	}
+
+	if !ok {
+		return &Usage{Unknown: true}
+	}
+
+	return usage
+}
+
+// Forget removes the cached usage of the volume, while refreshes still in progress are discarded.
+func (c *UsageCache) Forget(volumeID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.usages, volumeID)
+	delete(c.refreshing, volumeID)
+}
+
+func (c *UsageCache) refresh(vol *Volume, generation uint64) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	usage := &Usage{
+		Updated: time.Now(),
+	}
+
+	client, err := s3.CreateClientFromConfig(vol.config())
+	if err == nil {
+		usage.UsedBytes, usage.Objects, err = client.GetUsage(ctx, vol.Meta.BucketName, path.Join(vol.Meta.Prefix, vol.Meta.FSPath))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The volume has been forgotten while its usage was refreshed
+	if current, ok := c.refreshing[vol.VolumeId]; !ok || current != generation {
+		return
+	}
+	delete(c.refreshing, vol.VolumeId)
+
+	if err != nil {
+		log.Printf("Unable to refresh usage of volume %s: %v", vol.VolumeId, err)
+		usage.Err = err
+
+		// Keeps reporting the last known usage
+		if previous, ok := c.usages[vol.VolumeId]; ok {
+			usage.UsedBytes = previous.UsedBytes
+			usage.Objects = previous.Objects
+		}
+	}
+
+	c.usages[vol.VolumeId] = usage
+}
@@ -2,45 +2,136 @@ package node
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"sync"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/glog"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/common/mount"
 	"github.com/mwantia/nomad-csi-s3-plugin/pkg/mounter"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
 )
 
 type Volume struct {
 	VolumeId string
+	Meta     *s3.FSMeta
+	Cfg      *s3.S3Config
 	// volume's real mount point
 	stagingTargetPath string
-	// Target paths to which the volume has been published.
+	capability        *csi.VolumeCapability
+	// Target paths to which the volume has been published and whether they are read-only.
 	// These paths are symbolic links to the real mount point.
 	// So multiple pods using the same volume can share a mount.
 	targetPaths map[string]bool
 	mounter     mounter.Mounter
+	// Set if the usage exceeds the capacity of a volume with a node quota, which forces all targets to be read-only
+	quotaExceeded bool
+	// Passphrase of the client-side encryption, which is only kept in memory and never persisted
+	clientKey string
+	// Alias of the secrets the volume has been staged with, which is used to request its credentials again after a restart
+	alias string
+	// Last restart of the mount by the supervisor, which is reported as part of the volume condition
+	restart *mounter.Event
+	// Guards the fields persisted by State, as the state of all volumes is saved while only the mutex of a single volume is held
+	mu sync.Mutex
 }
 
-func NewVolume(volumeID string, mounter mounter.Mounter) *Volume {
+func NewVolume(volumeID string, meta *s3.FSMeta, cfg *s3.S3Config, mounter mounter.Mounter) *Volume {
 	return &Volume{
 		VolumeId:    volumeID,
+		Meta:        meta,
+		Cfg:         cfg,
 		mounter:     mounter,
 		targetPaths: make(map[string]bool),
 	}
 }
 
-func (vol *Volume) Stage(ctx context.Context, path string) error {
+func (vol *Volume) Stage(ctx context.Context, path string, capability *csi.VolumeCapability) error {
 	staged := vol.IsStaged()
 
 	if staged {
 		return nil
 	}
 
-	if err := vol.mounter.Stage(ctx, path); err != nil {
+	if err := vol.stage(ctx, path, capability); err != nil {
 		return err
 	}
 
+	vol.mu.Lock()
+	defer vol.mu.Unlock()
+
 	vol.stagingTargetPath = path
+	vol.capability = capability
+	return nil
+}
+
+// stage mounts the volume at path. Volumes with client-side encryption are staged by their mounter to
+// the crypt path instead, while path exposes the decrypted files, so that only ciphertext reaches the bucket.
+func (vol *Volume) stage(ctx context.Context, path string, capability *csi.VolumeCapability) error {
+	if err := vol.missingSecrets(); err != nil {
+		return err
+	}
+
+	if !vol.IsEncrypted() {
+		return vol.mounter.Stage(ctx, path, capability)
+	}
+
+	cipherDir := mounter.CryptPath(path)
+	if _, err := mount.CheckMount(cipherDir); err != nil {
+		return err
+	}
+
+	if err := vol.mounter.Stage(ctx, cipherDir, capability); err != nil {
+		return err
+	}
+
+	if err := mounter.GocryptfsMount(ctx, cipherDir, path, vol.clientKey, mounter.IsReadOnly(capability)); err != nil {
+		if err := vol.mounter.Unstage(ctx, cipherDir); err != nil {
+			glog.Warningf("unable to unstage volume %s: %v", vol.VolumeId, err)
+		}
+		removeCryptPath(path)
+		return err
+	}
+
+	return nil
+}
+
+// unstage unmounts the volume from path, starting with its layer of client-side encryption.
+func (vol *Volume) unstage(ctx context.Context, path string) error {
+	if !vol.IsEncrypted() {
+		return vol.mounter.Unstage(ctx, path)
+	}
+
+	if err := mounter.FuseUnstage(ctx, path); err != nil {
+		return err
+	}
+
+	if err := vol.mounter.Unstage(ctx, mounter.CryptPath(path)); err != nil {
+		return err
+	}
+
+	removeCryptPath(path)
 	return nil
 }
 
+// removeCryptPath removes the crypt path next to the staging path, which is created by stage and
+// not known to the orchestrator. It is only removed if empty, so that unmounted data is never lost.
+func removeCryptPath(path string) {
+	if err := os.Remove(mounter.CryptPath(path)); err != nil && !os.IsNotExist(err) {
+		glog.Warningf("unable to remove %s: %v", mounter.CryptPath(path), err)
+	}
+}
+
+// Adopt takes over a staging path, which has already been mounted by a previous instance of the plugin.
+func (vol *Volume) Adopt(path string, capability *csi.VolumeCapability) {
+	vol.mu.Lock()
+	defer vol.mu.Unlock()
+
+	vol.stagingTargetPath = path
+	vol.capability = capability
+}
+
 func (vol *Volume) Unstage(ctx context.Context, path string) error {
 	staged := vol.IsStaged()
 
@@ -48,19 +139,22 @@ func (vol *Volume) Unstage(ctx context.Context, path string) error {
 		return nil
 	}
 
-	if err := vol.mounter.Unstage(ctx, vol.stagingTargetPath); err != nil {
+	if err := vol.unstage(ctx, vol.stagingTargetPath); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (vol *Volume) Publish(ctx context.Context, path string) error {
-	if err := vol.mounter.Mount(ctx, vol.stagingTargetPath, path); err != nil {
+func (vol *Volume) Publish(ctx context.Context, path string, capability *csi.VolumeCapability, readonly bool) error {
+	if err := vol.mounter.Mount(ctx, vol.stagingTargetPath, path, capability, readonly || vol.quotaExceeded); err != nil {
 		return err
 	}
 
-	vol.targetPaths[path] = true
+	vol.mu.Lock()
+	defer vol.mu.Unlock()
+
+	vol.targetPaths[path] = readonly
 	return nil
 }
 
@@ -74,10 +168,193 @@ func (vol *Volume) Unpublish(ctx context.Context, path string) error {
 		return err
 	}
 
+	vol.mu.Lock()
+	defer vol.mu.Unlock()
+
 	delete(vol.targetPaths, path)
 	return nil
 }
 
+// Repair detaches the mounts of a crashed or hung fuse process, then stages and publishes the volume again.
+func (vol *Volume) Repair(ctx context.Context) error {
+	if !vol.IsStaged() {
+		return nil
+	}
+
+	for target := range vol.targetPaths {
+		if err := mounter.LazyUnmount(target); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range vol.SupervisedPaths() {
+		if err := mounter.LazyUnmount(path); err != nil {
+			return err
+		}
+	}
+
+	// Releases everything else held by the mounter (e.g. loop devices), which may fail as the mounts are already gone
+	if err := vol.mounter.Unstage(ctx, vol.mounterPath()); err != nil {
+		glog.Warningf("unable to unstage volume %s: %v", vol.VolumeId, err)
+	}
+
+	if _, err := mount.CheckMount(vol.stagingTargetPath); err != nil {
+		return err
+	}
+
+	if err := vol.stage(ctx, vol.stagingTargetPath, vol.capability); err != nil {
+		return err
+	}
+
+	for target, readonly := range vol.targetPaths {
+		if err := vol.mounter.Mount(ctx, vol.stagingTargetPath, target, vol.capability, readonly || vol.quotaExceeded); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EnforceQuota remounts all targets read-only once the quota has been exceeded,
+// and restores the requested access after the usage dropped or the volume has been expanded.
+func (vol *Volume) EnforceQuota(exceeded bool) error {
+	if vol.quotaExceeded == exceeded {
+		return nil
+	}
+
+	for target, readonly := range vol.targetPaths {
+		if err := mounter.Remount(target, readonly || exceeded); err != nil {
+			return err
+		}
+	}
+
+	vol.mu.Lock()
+	defer vol.mu.Unlock()
+
+	vol.quotaExceeded = exceeded
+	return nil
+}
+
+func (vol *Volume) IsQuotaExceeded() bool {
+	return vol.quotaExceeded
+}
+
+// Capacity returns the capacity of the volume, which may be changed by an expansion at any time.
+func (vol *Volume) Capacity() int64 {
+	vol.mu.Lock()
+	defer vol.mu.Unlock()
+
+	return vol.Meta.CapacityBytes
+}
+
+// Expand raises the capacity of the volume, including the capacity reported by its mounter.
+// It returns false if the volume already has at least the capacity.
+func (vol *Volume) Expand(capacityBytes int64) bool {
+	vol.mu.Lock()
+	defer vol.mu.Unlock()
+
+	if vol.Meta.CapacityBytes >= capacityBytes {
+		return false
+	}
+
+	vol.Meta.CapacityBytes = capacityBytes
+	if setter, ok := vol.mounter.(mounter.CapacitySetter); ok {
+		setter.SetCapacity(capacityBytes)
+	}
+
+	return true
+}
+
+// missingSecrets returns an error if the volume can't be staged again, as its credentials
+// are never persisted and haven't been provided again since the plugin has been restarted.
+func (vol *Volume) missingSecrets() error {
+	vol.mu.Lock()
+	defer vol.mu.Unlock()
+
+	if len(vol.Cfg.AccessKeyID) <= 0 {
+		return fmt.Errorf("credentials of volume %s are unknown until it is staged or published again", vol.VolumeId)
+	}
+
+	if vol.Meta.Encryption == s3.EncryptionSSEC && len(vol.Cfg.SSECustomerKey) <= 0 {
+		return fmt.Errorf("customer key of volume %s is unknown until it is staged or published again", vol.VolumeId)
+	}
+
+	if vol.IsEncrypted() && len(vol.clientKey) <= 0 {
+		return fmt.Errorf("client encryption key of volume %s is unknown until it is staged or published again", vol.VolumeId)
+	}
+
+	return nil
+}
+
+// setSecrets restores the credentials and keys of the volume, the config is updated in place as it is shared with the mounter.
+func (vol *Volume) setSecrets(cfg *s3.S3Config, secrets map[string]string) {
+	vol.mu.Lock()
+	defer vol.mu.Unlock()
+
+	vol.Cfg.AccessKeyID = cfg.AccessKeyID
+	vol.Cfg.SecretAccessKey = cfg.SecretAccessKey
+	if len(cfg.SSECustomerKey) > 0 {
+		vol.Cfg.SSECustomerKey = cfg.SSECustomerKey
+	}
+	if key := secrets["clientEncryptionKey"]; len(key) > 0 {
+		vol.clientKey = key
+	}
+	vol.alias = secrets["alias"]
+}
+
+// config returns a copy of the config, which can be used without holding the mutex of the volume.
+func (vol *Volume) config() *s3.S3Config {
+	vol.mu.Lock()
+	defer vol.mu.Unlock()
+
+	cfg := *vol.Cfg
+	return &cfg
+}
+
+// setRestart records the latest restart of the mount by the supervisor.
+func (vol *Volume) setRestart(event mounter.Event) {
+	vol.mu.Lock()
+	defer vol.mu.Unlock()
+
+	vol.restart = &event
+}
+
+// lastRestart returns the latest restart of the mount by the supervisor, or nil if it hasn't been restarted yet.
+func (vol *Volume) lastRestart() *mounter.Event {
+	vol.mu.Lock()
+	defer vol.mu.Unlock()
+
+	return vol.restart
+}
+
+// SupervisedPaths returns the paths that have to be probed to determine the health of the staged volume.
+func (vol *Volume) SupervisedPaths() []string {
+	paths := mounter.SupervisedPaths(vol.mounter, vol.mounterPath())
+	if vol.IsEncrypted() {
+		return append([]string{vol.stagingTargetPath}, paths...)
+	}
+
+	return paths
+}
+
+// mounterPath returns the path the mounter has staged the volume to.
+func (vol *Volume) mounterPath() string {
+	if vol.IsEncrypted() {
+		return mounter.CryptPath(vol.stagingTargetPath)
+	}
+
+	return vol.stagingTargetPath
+}
+
+func (vol *Volume) IsEncrypted() bool {
+	return len(vol.Meta.ClientEncryption) > 0
+}
+
+func (vol *Volume) IsPublished(path string) bool {
+	_, ok := vol.targetPaths[path]
+	return ok
+}
+
 func (vol *Volume) IsStaged() bool {
 	return vol.stagingTargetPath != ""
 }
@@ -9,6 +9,7 @@ import (
 	"log"
 	"net/url"
 	"path"
+	"strings"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -25,36 +26,77 @@ type S3Client struct {
 }
 
 type S3Config struct {
-	Endpoint        string `json:"endpoint"`
-	Region          string `json:"region"`
-	AccessKeyID     string `json:"accesskey"`
-	SecretAccessKey string `json:"secretkey"`
-	Mounter         string `json:"mounter"`
+	Endpoint        string   `json:"endpoint"`
+	Region          string   `json:"region"`
+	AccessKeyID     string   `json:"accesskey"`
+	SecretAccessKey string   `json:"secretkey"`
+	Mounter         string   `json:"mounter"`
+	MountOptions    []string `json:"mountoptions,omitempty"`
+	// Customer key of volumes using SSE-C, which is never stored within the bucket
+	SSECustomerKey string `json:"-"`
 }
 
 type FSMeta struct {
-	BucketName    string `json:"name"`
-	Prefix        string `json:"prefix"`
-	UsePrefix     bool   `json:"useprefix"`
-	Mounter       string `json:"mounter"`
-	FSPath        string `json:"fspath"`
-	CapacityBytes int64  `json:"capacitybytes"`
+	BucketName    string   `json:"name"`
+	Prefix        string   `json:"prefix"`
+	UsePrefix     bool     `json:"useprefix"`
+	Mounter       string   `json:"mounter"`
+	FSPath        string   `json:"fspath"`
+	CapacityBytes int64    `json:"capacitybytes"`
+	VfsCacheMode  string   `json:"vfscachemode,omitempty"`
+	BlockSize     string   `json:"blocksize,omitempty"`
+	MountOptions  []string `json:"mountoptions,omitempty"`
+	UID           string   `json:"uid,omitempty"`
+	GID           string   `json:"gid,omitempty"`
+	FileMode      string   `json:"filemode,omitempty"`
+	DirMode       string   `json:"dirmode,omitempty"`
+	UserMap       string   `json:"usermap,omitempty"`
+	Quota         string   `json:"quota,omitempty"`
+	Alias         string   `json:"alias,omitempty"`
+	// Set if the volume is mounted with the credentials of its own service account
+	ScopedCredentials bool       `json:"scopedcredentials,omitempty"`
+	Versioning        string     `json:"versioning,omitempty"`
+	Lifecycle         *Lifecycle `json:"lifecycle,omitempty"`
+	// Set if the bucket of the volume has been created with object lock enabled
+	ObjectLock    bool   `json:"objectlock,omitempty"`
+	RetentionMode string `json:"retentionmode,omitempty"`
+	RetentionDays int    `json:"retentiondays,omitempty"`
+	Encryption    string `json:"encryption,omitempty"`
+	KMSKeyID      string `json:"kmskeyid,omitempty"`
+	// Layer of client-side encryption stacked on top of the mounter
+	ClientEncryption string `json:"clientencryption,omitempty"`
+	// Labels of the volume, which are applied as tags to its bucket or metadata
+	Tags map[string]string `json:"tags,omitempty"`
+	// Snapshot or volume the volume has been created from, so that requests with another source don't reuse it
+	ContentSource string `json:"contentsource,omitempty"`
+	// Set once the content source of the volume has been copied, so that retries don't copy it again
+	ContentCopied bool `json:"contentcopied,omitempty"`
 }
 
-func CreateClientFromConfig(cfg *S3Config) (*S3Client, error) {
-	u, err := url.Parse(cfg.Endpoint)
+// parseEndpoint returns the host of the endpoint and whether it uses https.
+func parseEndpoint(endpoint string) (string, bool, error) {
+	u, err := url.Parse(endpoint)
 	if err != nil {
-		return nil, err
+		return "", false, err
 	}
 
-	endpoint := u.Hostname()
+	host := u.Hostname()
 	if u.Port() != "" {
-		endpoint = u.Hostname() + ":" + u.Port()
+		host = u.Hostname() + ":" + u.Port()
+	}
+
+	return host, u.Scheme == "https", nil
+}
+
+func CreateClientFromConfig(cfg *S3Config) (*S3Client, error) {
+	endpoint, secure, err := parseEndpoint(cfg.Endpoint)
+	if err != nil {
+		return nil, err
 	}
 
 	m, err := minio.New(endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.Region),
-		Secure: u.Scheme == "https",
+		Secure: secure,
 	})
 	if err != nil {
 		return nil, err
@@ -75,6 +117,8 @@ func CreateClient(cfg *config.DriverConfig, secret map[string]string) (*S3Client
 					Region:          a.Region,
 					AccessKeyID:     a.AccessKeyID,
 					SecretAccessKey: a.SecretAccessKey,
+					MountOptions:    a.MountOptions,
+					SSECustomerKey:  secret["encryptionKey"],
 				})
 			}
 		}
@@ -87,6 +131,7 @@ func CreateClient(cfg *config.DriverConfig, secret map[string]string) (*S3Client
 		Region:          secret["region"],
 		AccessKeyID:     secret["accessKeyID"],
 		SecretAccessKey: secret["secretAccessKey"],
+		SSECustomerKey:  secret["encryptionKey"],
 	})
 }
 
@@ -99,9 +144,10 @@ func (c *S3Client) BucketExists(ctx context.Context, bucketName string) (bool, e
 	return exists, nil
 }
 
-func (c *S3Client) CreateBucket(ctx context.Context, bucketName string) error {
+func (c *S3Client) CreateBucket(ctx context.Context, bucketName string, objectLocking bool) error {
 	err := c.Minio.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{
-		Region: c.Config.Region,
+		Region:        c.Config.Region,
+		ObjectLocking: objectLocking,
 	})
 	if err != nil {
 		return err
@@ -119,6 +165,28 @@ func (c *S3Client) CreatePrefix(ctx context.Context, bucketName string, prefix s
 	return nil
 }
 
+// GetUsage returns the total size and number of all objects below the prefix.
+func (c *S3Client) GetUsage(ctx context.Context, bucketName, prefix string) (int64, int64, error) {
+	if len(prefix) > 0 && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var size, objects int64
+	for object := range c.Minio.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return 0, 0, object.Err
+		}
+
+		size += object.Size
+		objects++
+	}
+
+	return size, objects, nil
+}
+
 func (c *S3Client) RemovePrefix(ctx context.Context, bucketName string, prefix string) error {
 	var err error
 
@@ -155,13 +223,11 @@ func (c *S3Client) RemoveObjects(ctx context.Context, bucketName, prefix string)
 	objectsCh := make(chan minio.ObjectInfo)
 	var err error
 
+	listOpts := c.listObjectsOptions(ctx, bucketName, prefix)
 	go func() {
 		defer close(objectsCh)
 
-		for object := range c.Minio.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
-			Prefix:    prefix,
-			Recursive: true,
-		}) {
+		for object := range c.Minio.ListObjects(ctx, bucketName, listOpts) {
 			if object.Err != nil {
 				err = object.Err
 				return
@@ -174,9 +240,7 @@ func (c *S3Client) RemoveObjects(ctx context.Context, bucketName, prefix string)
 		return err
 	}
 
-	opts := minio.RemoveObjectsOptions{
-		GovernanceBypass: true,
-	}
+	opts := minio.RemoveObjectsOptions{}
 	errorCh := c.Minio.RemoveObjects(ctx, bucketName, objectsCh, opts)
 	haveErrWhenRemoveObjects := false
 	for e := range errorCh {
@@ -196,11 +260,11 @@ func (c *S3Client) RemoveObjectsOneByOne(ctx context.Context, bucketName, prefix
 	removeErrCh := make(chan minio.RemoveObjectError, 1)
 	var err error
 
+	listOpts := c.listObjectsOptions(ctx, bucketName, prefix)
 	go func() {
 		defer close(objectsCh)
 
-		for object := range c.Minio.ListObjects(ctx, bucketName,
-			minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		for object := range c.Minio.ListObjects(ctx, bucketName, listOpts) {
 			if object.Err != nil {
 				err = object.Err
 				return
@@ -242,10 +306,16 @@ func (c *S3Client) RemoveObjectsOneByOne(ctx context.Context, bucketName, prefix
 }
 
 func (c *S3Client) SetFSMeta(ctx context.Context, meta *FSMeta) error {
+	encryption, err := c.metadataEncryption(meta)
+	if err != nil {
+		return err
+	}
+
 	b := new(bytes.Buffer)
 	json.NewEncoder(b).Encode(meta)
-	opts := minio.PutObjectOptions{ContentType: "application/json"}
-	_, err := c.Minio.PutObject(ctx, meta.BucketName, path.Join(meta.Prefix, MetadataName), b, int64(b.Len()), opts)
+	// Tags are applied to the metadata, so that volumes sharing a bucket can be attributed as well
+	opts := minio.PutObjectOptions{ContentType: "application/json", ServerSideEncryption: encryption, UserTags: meta.Tags}
+	_, err = c.Minio.PutObject(ctx, meta.BucketName, path.Join(meta.Prefix, MetadataName), b, int64(b.Len()), opts)
 	if err != nil {
 		return err
 	}
@@ -254,16 +324,11 @@ func (c *S3Client) SetFSMeta(ctx context.Context, meta *FSMeta) error {
 }
 
 func (c *S3Client) GetFSMeta(ctx context.Context, bucketName, prefix string) (*FSMeta, error) {
-	opts := minio.GetObjectOptions{}
-	obj, err := c.Minio.GetObject(ctx, bucketName, path.Join(prefix, MetadataName), opts)
-	if err != nil {
-		return &FSMeta{}, err
-	}
-
-	objInfo, err := obj.Stat()
+	obj, objInfo, err := c.openObject(ctx, bucketName, path.Join(prefix, MetadataName))
 	if err != nil {
 		return &FSMeta{}, err
 	}
+	defer obj.Close()
 
 	if objInfo.Size <= 0 {
 		return &FSMeta{}, fmt.Errorf("invalid size defined for object")
@@ -284,3 +349,66 @@ func (c *S3Client) GetFSMeta(ctx context.Context, bucketName, prefix string) (*F
 
 	return &meta, nil
 }
+
+// ListFSMetas returns the metadata of all volumes within the bucket. As volume ids consist of the bucket and a single prefix,
+// metadata is only searched at the root of the bucket and directly below each prefix, instead of walking the data of the volumes.
+func (c *S3Client) ListFSMetas(ctx context.Context, bucketName string) ([]*FSMeta, error) {
+	var root *FSMeta
+	dirs := make([]string, 0)
+	for object := range c.Minio.ListObjects(ctx, bucketName, minio.ListObjectsOptions{}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+
+		if strings.HasSuffix(object.Key, "/") {
+			dirs = append(dirs, strings.TrimSuffix(object.Key, "/"))
+			continue
+		}
+
+		if object.Key == MetadataName {
+			root = c.findFSMeta(ctx, bucketName, "")
+		}
+	}
+
+	metas := make([]*FSMeta, 0)
+	if root != nil {
+		metas = append(metas, root)
+
+		// Volumes using the bucket as existing prefix store their data directly within it
+		if root.FSPath == "" {
+			return metas, nil
+		}
+	}
+
+	for _, dir := range dirs {
+		// Skips the data and snapshots of the volume using the bucket
+		if root != nil && (dir == root.FSPath || dir == SnapshotsPath) {
+			continue
+		}
+
+		if meta := c.findFSMeta(ctx, bucketName, dir); meta != nil {
+			metas = append(metas, meta)
+		}
+	}
+
+	return metas, nil
+}
+
+// findFSMeta returns the metadata of the volume at prefix, or nil if there is no valid metadata belonging to it.
+func (c *S3Client) findFSMeta(ctx context.Context, bucketName, prefix string) *FSMeta {
+	meta, err := c.GetFSMeta(ctx, bucketName, prefix)
+	if err != nil {
+		// Prefixes without metadata are no volumes, e.g. the directories of a volume using an existing prefix
+		if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			log.Printf("Ignoring invalid metadata %s/%s", bucketName, path.Join(prefix, MetadataName))
+		}
+		return nil
+	}
+
+	if meta.BucketName != bucketName || meta.Prefix != prefix {
+		log.Printf("Ignoring invalid metadata %s/%s", bucketName, path.Join(prefix, MetadataName))
+		return nil
+	}
+
+	return meta
+}
@@ -0,0 +1,118 @@
+package s3_test
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3/s3test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func putMeta(server *s3test.Server, meta *s3.FSMeta) {
+	b, err := json.Marshal(meta)
+	Expect(err).NotTo(HaveOccurred())
+
+	server.Put(meta.BucketName, path.Join(meta.Prefix, s3.MetadataName), string(b))
+}
+
+func prefixes(metas []*s3.FSMeta) []string {
+	found := make([]string, 0, len(metas))
+	for _, meta := range metas {
+		found = append(found, meta.Prefix)
+	}
+
+	return found
+}
+
+var _ = Describe("ListFSMetas", func() {
+	var (
+		ctx    context.Context
+		server *s3test.Server
+		client *s3.S3Client
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		server = s3test.NewServer("bucket")
+		client = server.Client()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should return no volumes for an empty bucket", func() {
+		metas, err := client.ListFSMetas(ctx, "bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metas).To(BeEmpty())
+	})
+
+	It("should find the volume using the whole bucket", func() {
+		putMeta(server, &s3.FSMeta{BucketName: "bucket", FSPath: "fs", CapacityBytes: 1024})
+		server.Put("bucket", "fs/file", "content")
+
+		metas, err := client.ListFSMetas(ctx, "bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metas).To(HaveLen(1))
+		Expect(metas[0].CapacityBytes).To(Equal(int64(1024)))
+	})
+
+	It("should find volumes at the first level of prefixes", func() {
+		putMeta(server, &s3.FSMeta{BucketName: "bucket", Prefix: "vol-a", FSPath: "fs"})
+		putMeta(server, &s3.FSMeta{BucketName: "bucket", Prefix: "vol-b", UsePrefix: true})
+		putMeta(server, &s3.FSMeta{BucketName: "bucket", Prefix: "team/vol-c", UsePrefix: true, FSPath: "fs"})
+		server.Put("bucket", "team/other/file", "content")
+
+		metas, err := client.ListFSMetas(ctx, "bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prefixes(metas)).To(ConsistOf("vol-a", "vol-b"))
+	})
+
+	It("should not search the data and snapshots of the volume using the bucket", func() {
+		putMeta(server, &s3.FSMeta{BucketName: "bucket", FSPath: "fs"})
+		putMeta(server, &s3.FSMeta{BucketName: "bucket", Prefix: "fs", FSPath: "fs"})
+		putMeta(server, &s3.FSMeta{BucketName: "bucket", Prefix: s3.SnapshotsPath, FSPath: "fs"})
+		putMeta(server, &s3.FSMeta{BucketName: "bucket", Prefix: "vol", FSPath: "fs"})
+
+		metas, err := client.ListFSMetas(ctx, "bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prefixes(metas)).To(ConsistOf("", "vol"))
+	})
+
+	It("should not search below volumes storing their data next to their metadata", func() {
+		putMeta(server, &s3.FSMeta{BucketName: "bucket", UsePrefix: true})
+		putMeta(server, &s3.FSMeta{BucketName: "bucket", Prefix: "nested", UsePrefix: true, FSPath: "fs"})
+
+		metas, err := client.ListFSMetas(ctx, "bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prefixes(metas)).To(ConsistOf(""))
+	})
+
+	It("should ignore metadata belonging to another location", func() {
+		putMeta(server, &s3.FSMeta{BucketName: "bucket", Prefix: "vol", UsePrefix: true, FSPath: "fs"})
+		server.Put("bucket", path.Join("moved", s3.MetadataName), `{"name":"bucket","prefix":"vol","fspath":"fs"}`)
+		server.Put("bucket", path.Join("broken", s3.MetadataName), "{")
+
+		metas, err := client.ListFSMetas(ctx, "bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prefixes(metas)).To(ConsistOf("vol"))
+	})
+
+	It("should skip the markers of directories", func() {
+		server.Put("bucket", "vol/", "")
+		server.Put("bucket", "empty/", "")
+		putMeta(server, &s3.FSMeta{BucketName: "bucket", Prefix: "vol", FSPath: "fs"})
+
+		metas, err := client.ListFSMetas(ctx, "bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prefixes(metas)).To(ConsistOf("vol"))
+	})
+
+	It("should fail for missing buckets", func() {
+		_, err := client.ListFSMetas(ctx, "missing")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,222 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/minio/madmin-go/v3"
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	// Scoped credentials are stored next to the metadata of their volume
+	CredentialsName = ".credentials.json"
+)
+
+// VolumeCredentials are the credentials of a service account, which can only access the bucket or prefix of a single volume.
+type VolumeCredentials struct {
+	AccessKeyID     string `json:"accesskey"`
+	SecretAccessKey string `json:"secretkey"`
+}
+
+type policy struct {
+	Version   string      `json:"Version"`
+	Statement []statement `json:"Statement"`
+}
+
+type statement struct {
+	Effect    string                       `json:"Effect"`
+	Action    []string                     `json:"Action"`
+	Resource  []string                     `json:"Resource"`
+	Condition map[string]map[string]string `json:"Condition,omitempty"`
+}
+
+// VolumePolicy returns a policy, which only allows access to the data of the volume.
+// Volumes storing their data next to their metadata are denied to modify it and their snapshots, or to read their credentials.
+func VolumePolicy(meta *FSMeta) ([]byte, error) {
+	bucket := "arn:aws:s3:::" + meta.BucketName
+	data := path.Join(meta.Prefix, meta.FSPath)
+
+	objects := bucket + "/*"
+	list := statement{
+		Effect:   "Allow",
+		Action:   []string{"s3:ListBucket"},
+		Resource: []string{bucket},
+	}
+
+	if len(data) > 0 {
+		objects = bucket + "/" + data + "/*"
+		list.Condition = map[string]map[string]string{
+			"StringLike": {
+				"s3:prefix": data + "/*",
+			},
+		}
+	}
+
+	return json.Marshal(&policy{
+		Version: "2012-10-17",
+		Statement: []statement{
+			{
+				Effect:   "Allow",
+				Action:   []string{"s3:GetBucketLocation", "s3:ListBucketMultipartUploads"},
+				Resource: []string{bucket},
+			},
+			list,
+			{
+				Effect: "Allow",
+				Action: []string{
+					"s3:GetObject",
+					"s3:PutObject",
+					"s3:DeleteObject",
+					"s3:AbortMultipartUpload",
+					"s3:ListMultipartUploadParts",
+				},
+				Resource: []string{objects},
+			},
+			{
+				Effect:   "Deny",
+				Action:   []string{"s3:*"},
+				Resource: []string{bucket + "/" + path.Join(meta.Prefix, CredentialsName)},
+			},
+			{
+				Effect: "Deny",
+				Action: []string{"s3:PutObject", "s3:DeleteObject"},
+				Resource: []string{
+					bucket + "/" + path.Join(meta.Prefix, MetadataName),
+					bucket + "/" + path.Join(meta.Prefix, SnapshotsPath) + "/*",
+					bucket + "/" + path.Join(meta.Prefix, SnapshotMetaPrefix) + "*",
+				},
+			},
+		},
+	})
+}
+
+// CreateVolumeCredentials creates a service account, which is limited to the volume, and stores its credentials.
+// Existing credentials of the volume are returned as is, so that repeated requests don't create further accounts.
+func (c *S3Client) CreateVolumeCredentials(ctx context.Context, meta *FSMeta, description string) (*VolumeCredentials, error) {
+	creds, err := c.GetVolumeCredentials(ctx, meta.BucketName, meta.Prefix)
+	if err == nil {
+		return creds, nil
+	}
+
+	// Credentials that can't be read must not be replaced, as their account would be lost otherwise
+	if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return nil, fmt.Errorf("failed to read credentials: %w", err)
+	}
+
+	policy, err := VolumePolicy(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := c.CreateAdminClient()
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := admin.AddServiceAccount(ctx, madmin.AddServiceAccountReq{
+		Policy:      policy,
+		Description: description,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service account: %w", err)
+	}
+
+	creds = &VolumeCredentials{
+		AccessKeyID:     account.AccessKey,
+		SecretAccessKey: account.SecretKey,
+	}
+
+	encryption, err := c.ServerSideEncryption(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	b := new(bytes.Buffer)
+	json.NewEncoder(b).Encode(creds)
+	opts := minio.PutObjectOptions{ContentType: "application/json", ServerSideEncryption: encryption}
+	if _, err := c.Minio.PutObject(ctx, meta.BucketName, path.Join(meta.Prefix, CredentialsName), b, int64(b.Len()), opts); err != nil {
+		// Removes the account again, as its credentials would be lost otherwise
+		if err := admin.DeleteServiceAccount(ctx, account.AccessKey); err != nil {
+			return nil, fmt.Errorf("failed to remove service account %s: %w", account.AccessKey, err)
+		}
+
+		return nil, err
+	}
+
+	return creds, nil
+}
+
+func (c *S3Client) GetVolumeCredentials(ctx context.Context, bucketName, prefix string) (*VolumeCredentials, error) {
+	obj, _, err := c.openObject(ctx, bucketName, path.Join(prefix, CredentialsName))
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	b, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds VolumeCredentials
+	if err := json.Unmarshal(b, &creds); err != nil {
+		return nil, err
+	}
+
+	return &creds, nil
+}
+
+// RevokeVolumeCredentials removes the service account of the volume, followed by its stored credentials.
+func (c *S3Client) RevokeVolumeCredentials(ctx context.Context, bucketName, prefix string) error {
+	creds, err := c.FindVolumeCredentials(ctx, bucketName, prefix)
+	if err != nil || creds == nil {
+		return err
+	}
+
+	if err := c.RemoveServiceAccount(ctx, creds); err != nil {
+		return err
+	}
+
+	return c.Minio.RemoveObject(ctx, bucketName, path.Join(prefix, CredentialsName), minio.RemoveObjectOptions{})
+}
+
+// FindVolumeCredentials behaves like GetVolumeCredentials, but returns nil if the volume has no credentials.
+func (c *S3Client) FindVolumeCredentials(ctx context.Context, bucketName, prefix string) (*VolumeCredentials, error) {
+	creds, err := c.GetVolumeCredentials(ctx, bucketName, prefix)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return creds, nil
+}
+
+// RemoveServiceAccount removes the service account of the credentials, which is ignored if it has already been removed.
+func (c *S3Client) RemoveServiceAccount(ctx context.Context, creds *VolumeCredentials) error {
+	admin, err := c.CreateAdminClient()
+	if err != nil {
+		return err
+	}
+
+	if err := admin.DeleteServiceAccount(ctx, creds.AccessKeyID); err != nil && madmin.ToErrorResponse(err).Code != "XMinioAdminServiceAccountNotFound" {
+		return fmt.Errorf("failed to remove service account %s: %w", creds.AccessKeyID, err)
+	}
+
+	return nil
+}
+
+// WithCredentials returns a copy of the config, which uses the scoped credentials of a volume.
+func (cfg *S3Config) WithCredentials(creds *VolumeCredentials) *S3Config {
+	scoped := *cfg
+	scoped.AccessKeyID = creds.AccessKeyID
+	scoped.SecretAccessKey = creds.SecretAccessKey
+
+	return &scoped
+}
@@ -0,0 +1,93 @@
+package s3_test
+
+import (
+	"encoding/json"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+type testStatement struct {
+	Effect    string                       `json:"Effect"`
+	Action    []string                     `json:"Action"`
+	Resource  []string                     `json:"Resource"`
+	Condition map[string]map[string]string `json:"Condition"`
+}
+
+type testPolicy struct {
+	Version   string          `json:"Version"`
+	Statement []testStatement `json:"Statement"`
+}
+
+func volumePolicy(meta *s3.FSMeta) *testPolicy {
+	b, err := s3.VolumePolicy(meta)
+	Expect(err).NotTo(HaveOccurred())
+
+	var p testPolicy
+	Expect(json.Unmarshal(b, &p)).To(Succeed())
+
+	return &p
+}
+
+// statementFor returns the statement with the effect, which contains the action.
+func statementFor(p *testPolicy, effect, action string) testStatement {
+	for _, s := range p.Statement {
+		if s.Effect != effect {
+			continue
+		}
+
+		for _, a := range s.Action {
+			if a == action {
+				return s
+			}
+		}
+	}
+
+	Fail("no statement with effect " + effect + " contains action " + action)
+	return testStatement{}
+}
+
+var _ = Describe("VolumePolicy", func() {
+	DescribeTable("should only allow access to the data of the volume",
+		func(meta *s3.FSMeta, objects string, listPrefix string) {
+			p := volumePolicy(meta)
+			Expect(p.Version).To(Equal("2012-10-17"))
+
+			Expect(statementFor(p, "Allow", "s3:PutObject").Resource).To(Equal([]string{objects}))
+
+			list := statementFor(p, "Allow", "s3:ListBucket")
+			Expect(list.Resource).To(Equal([]string{"arn:aws:s3:::" + meta.BucketName}))
+			if len(listPrefix) > 0 {
+				Expect(list.Condition).To(Equal(map[string]map[string]string{
+					"StringLike": {"s3:prefix": listPrefix},
+				}))
+			} else {
+				Expect(list.Condition).To(BeEmpty())
+			}
+		},
+		Entry("bucket without data path", &s3.FSMeta{BucketName: "bucket"}, "arn:aws:s3:::bucket/*", ""),
+		Entry("bucket", &s3.FSMeta{BucketName: "bucket", FSPath: "fs"}, "arn:aws:s3:::bucket/fs/*", "fs/*"),
+		Entry("prefix", &s3.FSMeta{BucketName: "bucket", Prefix: "team/vol", FSPath: "fs"}, "arn:aws:s3:::bucket/team/vol/fs/*", "team/vol/fs/*"),
+		Entry("existing prefix", &s3.FSMeta{BucketName: "bucket", Prefix: "shared", UsePrefix: true}, "arn:aws:s3:::bucket/shared/*", "shared/*"),
+	)
+
+	It("should deny any access to the credentials of the volume", func() {
+		p := volumePolicy(&s3.FSMeta{BucketName: "bucket", Prefix: "vol"})
+
+		Expect(statementFor(p, "Deny", "s3:*").Resource).To(Equal([]string{
+			"arn:aws:s3:::bucket/vol/" + s3.CredentialsName,
+		}))
+	})
+
+	It("should deny to modify the metadata and snapshots of the volume", func() {
+		p := volumePolicy(&s3.FSMeta{BucketName: "bucket", Prefix: "vol"})
+
+		Expect(statementFor(p, "Deny", "s3:PutObject").Resource).To(ConsistOf(
+			"arn:aws:s3:::bucket/vol/"+s3.MetadataName,
+			"arn:aws:s3:::bucket/vol/"+s3.SnapshotsPath+"/*",
+			"arn:aws:s3:::bucket/vol/"+s3.SnapshotMetaPrefix+"*",
+		))
+	})
+})
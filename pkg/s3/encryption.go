@@ -0,0 +1,119 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/minio/minio-go/v7/pkg/sse"
+)
+
+const (
+	EncryptionSSES3  = "sse-s3"
+	EncryptionSSEKMS = "sse-kms"
+	EncryptionSSEC   = "sse-c"
+
+	// Customer keys of SSE-C are raw AES-256 keys
+	CustomerKeyLength = 32
+)
+
+var EncryptionModes = []string{EncryptionSSES3, EncryptionSSEKMS, EncryptionSSEC}
+
+// IsValidEncryption returns true if mode is empty or one of EncryptionModes.
+func IsValidEncryption(mode string) bool {
+	if len(mode) <= 0 {
+		return true
+	}
+
+	for _, m := range EncryptionModes {
+		if m == mode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetBucketEncryption sets the default encryption of the bucket, which is applied to every object written without encryption.
+// Customer keys can't be used as default encryption, as they are only known to the client.
+func (c *S3Client) SetBucketEncryption(ctx context.Context, meta *FSMeta) error {
+	switch meta.Encryption {
+	case EncryptionSSES3:
+		return c.Minio.SetBucketEncryption(ctx, meta.BucketName, sse.NewConfigurationSSES3())
+	case EncryptionSSEKMS:
+		return c.Minio.SetBucketEncryption(ctx, meta.BucketName, sse.NewConfigurationSSEKMS(meta.KMSKeyID))
+	}
+
+	return fmt.Errorf("encryption '%s' can't be used as default encryption of a bucket", meta.Encryption)
+}
+
+// ServerSideEncryption returns the encryption of objects written to the volume, or nil if the volume isn't encrypted.
+func (c *S3Client) ServerSideEncryption(meta *FSMeta) (encrypt.ServerSide, error) {
+	switch meta.Encryption {
+	case EncryptionSSES3:
+		return encrypt.NewSSE(), nil
+	case EncryptionSSEKMS:
+		return encrypt.NewSSEKMS(meta.KMSKeyID, nil)
+	case EncryptionSSEC:
+		return c.customerKey()
+	}
+
+	return nil, nil
+}
+
+// metadataEncryption returns the encryption of the metadata of the volume. The metadata of volumes using a customer key
+// isn't encrypted with it, as it has to be readable by requests without secrets (e.g. ListVolumes or GetCapacity).
+// It only contains the parameters of the volume and is still covered by the default encryption of the bucket, if any.
+func (c *S3Client) metadataEncryption(meta *FSMeta) (encrypt.ServerSide, error) {
+	if meta.Encryption == EncryptionSSEC {
+		return nil, nil
+	}
+
+	return c.ServerSideEncryption(meta)
+}
+
+func (c *S3Client) customerKey() (encrypt.ServerSide, error) {
+	if len(c.Config.SSECustomerKey) <= 0 {
+		return nil, fmt.Errorf("encryption '%s' requires the secret 'encryptionKey' to be defined", EncryptionSSEC)
+	}
+
+	return encrypt.NewSSEC([]byte(c.Config.SSECustomerKey))
+}
+
+// openObject returns the object along with its info. Objects encrypted with a customer key (e.g. the metadata of
+// volumes created before it was written without it) can only be read with the same key, so the read is repeated
+// with the key of the client if it fails.
+func (c *S3Client) openObject(ctx context.Context, bucketName, objectName string) (*minio.Object, minio.ObjectInfo, error) {
+	obj, err := c.Minio.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+
+	info, err := obj.Stat()
+	if err == nil {
+		return obj, info, nil
+	}
+	obj.Close()
+
+	if len(c.Config.SSECustomerKey) <= 0 {
+		return nil, minio.ObjectInfo{}, err
+	}
+
+	key, err := c.customerKey()
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+
+	obj, err = c.Minio.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{ServerSideEncryption: key})
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+
+	if info, err = obj.Stat(); err != nil {
+		obj.Close()
+		return nil, minio.ObjectInfo{}, err
+	}
+
+	return obj, info, nil
+}
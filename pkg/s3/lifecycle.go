@@ -0,0 +1,227 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+)
+
+const (
+	// All lifecycle parameters of a volume share this prefix
+	LifecycleParamPrefix = "lifecycle."
+
+	LifecycleExpirationDays                     = LifecycleParamPrefix + "expirationDays"
+	LifecycleExpirationPath                     = LifecycleParamPrefix + "expirationPath"
+	LifecycleNoncurrentVersionExpirationDays    = LifecycleParamPrefix + "noncurrentVersionExpirationDays"
+	LifecycleAbortIncompleteMultipartUploadDays = LifecycleParamPrefix + "abortIncompleteMultipartUploadDays"
+
+	// Identifies the lifecycle rules of the plugin within the lifecycle configuration of a bucket
+	lifecycleRulePrefix = "nomad-csi-s3:"
+)
+
+// Lifecycle are the lifecycle rules of a volume, which are limited to the data of the volume.
+type Lifecycle struct {
+	ExpirationDays int `json:"expirationdays,omitempty"`
+	// Path below the data of the volume, which is expired instead of all data
+	ExpirationPath                     string `json:"expirationpath,omitempty"`
+	NoncurrentVersionExpirationDays    int    `json:"noncurrentversionexpirationdays,omitempty"`
+	AbortIncompleteMultipartUploadDays int    `json:"abortincompletemultipartuploaddays,omitempty"`
+}
+
+// ParseLifecycle returns the lifecycle defined by the volume parameters, or nil if no lifecycle parameters are defined.
+func ParseLifecycle(params map[string]string) (*Lifecycle, error) {
+	l := &Lifecycle{}
+	found := false
+
+	for key, value := range params {
+		if !strings.HasPrefix(key, LifecycleParamPrefix) {
+			continue
+		}
+		found = true
+
+		var err error
+		switch key {
+		case LifecycleExpirationDays:
+			l.ExpirationDays, err = parseDays(value)
+		case LifecycleExpirationPath:
+			l.ExpirationPath = path.Clean("/" + value)[1:]
+			if l.ExpirationPath != strings.Trim(value, "/") {
+				err = fmt.Errorf("must be a relative path without '.' or '..'")
+			}
+		case LifecycleNoncurrentVersionExpirationDays:
+			l.NoncurrentVersionExpirationDays, err = parseDays(value)
+		case LifecycleAbortIncompleteMultipartUploadDays:
+			l.AbortIncompleteMultipartUploadDays, err = parseDays(value)
+		default:
+			err = fmt.Errorf("unknown lifecycle parameter")
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s': %w", key, value, err)
+		}
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	if len(l.ExpirationPath) > 0 && l.ExpirationDays == 0 {
+		return nil, fmt.Errorf("%s requires %s to be defined", LifecycleExpirationPath, LifecycleExpirationDays)
+	}
+
+	return l, nil
+}
+
+func parseDays(value string) (int, error) {
+	days, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if days <= 0 {
+		return 0, fmt.Errorf("must be a positive number of days")
+	}
+
+	return days, nil
+}
+
+// Params returns the volume parameters of the lifecycle.
+func (l *Lifecycle) Params() map[string]string {
+	params := make(map[string]string)
+
+	if l.ExpirationDays > 0 {
+		params[LifecycleExpirationDays] = strconv.Itoa(l.ExpirationDays)
+	}
+	if len(l.ExpirationPath) > 0 {
+		params[LifecycleExpirationPath] = l.ExpirationPath
+	}
+	if l.NoncurrentVersionExpirationDays > 0 {
+		params[LifecycleNoncurrentVersionExpirationDays] = strconv.Itoa(l.NoncurrentVersionExpirationDays)
+	}
+	if l.AbortIncompleteMultipartUploadDays > 0 {
+		params[LifecycleAbortIncompleteMultipartUploadDays] = strconv.Itoa(l.AbortIncompleteMultipartUploadDays)
+	}
+
+	return params
+}
+
+// Validate returns an error if the lifecycle would expire objects of the plugin (e.g. the metadata or snapshots),
+// which are stored next to the data of volumes without their own filesystem path.
+func (l *Lifecycle) Validate(meta *FSMeta) error {
+	if len(meta.FSPath) > 0 || l.ExpirationDays <= 0 {
+		return nil
+	}
+
+	if len(l.ExpirationPath) <= 0 {
+		return fmt.Errorf("%s requires %s to be defined for volumes sharing their path with the metadata", LifecycleExpirationDays, LifecycleExpirationPath)
+	}
+
+	// All objects of the plugin start with a '.' (e.g. '.metadata.json' or '.snapshots')
+	if strings.HasPrefix(l.ExpirationPath, ".") {
+		return fmt.Errorf("%s '%s' must not start with '.' for volumes sharing their path with the metadata", LifecycleExpirationPath, l.ExpirationPath)
+	}
+
+	return nil
+}
+
+// Rules returns the lifecycle rules of the volume, which are filtered by the path of its data.
+func (l *Lifecycle) Rules(meta *FSMeta) []lifecycle.Rule {
+	id := lifecycleRuleID(meta)
+	data := path.Join(meta.Prefix, meta.FSPath)
+	if len(data) > 0 {
+		data += "/"
+	}
+
+	rules := make([]lifecycle.Rule, 0)
+	if l.ExpirationDays > 0 {
+		prefix := data
+		if len(l.ExpirationPath) > 0 {
+			prefix = data + l.ExpirationPath + "/"
+		}
+
+		rules = append(rules, lifecycle.Rule{
+			ID:         id + "expiration",
+			Status:     "Enabled",
+			RuleFilter: lifecycle.Filter{Prefix: prefix},
+			Expiration: lifecycle.Expiration{
+				Days: lifecycle.ExpirationDays(l.ExpirationDays),
+			},
+		})
+	}
+
+	if l.NoncurrentVersionExpirationDays > 0 {
+		rules = append(rules, lifecycle.Rule{
+			ID:         id + "noncurrent-version-expiration",
+			Status:     "Enabled",
+			RuleFilter: lifecycle.Filter{Prefix: data},
+			NoncurrentVersionExpiration: lifecycle.NoncurrentVersionExpiration{
+				NoncurrentDays: lifecycle.ExpirationDays(l.NoncurrentVersionExpirationDays),
+			},
+		})
+	}
+
+	if l.AbortIncompleteMultipartUploadDays > 0 {
+		rules = append(rules, lifecycle.Rule{
+			ID:         id + "abort-incomplete-multipart-upload",
+			Status:     "Enabled",
+			RuleFilter: lifecycle.Filter{Prefix: data},
+			AbortIncompleteMultipartUpload: lifecycle.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: lifecycle.ExpirationDays(l.AbortIncompleteMultipartUploadDays),
+			},
+		})
+	}
+
+	return rules
+}
+
+func lifecycleRuleID(meta *FSMeta) string {
+	return lifecycleRulePrefix + path.Join(meta.BucketName, meta.Prefix) + ":"
+}
+
+// SetVolumeLifecycle replaces the lifecycle rules of the volume within the lifecycle configuration of its bucket,
+// which keeps the rules of other volumes sharing the same bucket.
+func (c *S3Client) SetVolumeLifecycle(ctx context.Context, meta *FSMeta) error {
+	var rules []lifecycle.Rule
+	if meta.Lifecycle != nil {
+		rules = meta.Lifecycle.Rules(meta)
+	}
+
+	return c.updateLifecycle(ctx, meta, rules)
+}
+
+// RemoveVolumeLifecycle removes the lifecycle rules of the volume from the lifecycle configuration of its bucket.
+func (c *S3Client) RemoveVolumeLifecycle(ctx context.Context, meta *FSMeta) error {
+	return c.updateLifecycle(ctx, meta, nil)
+}
+
+func (c *S3Client) updateLifecycle(ctx context.Context, meta *FSMeta, rules []lifecycle.Rule) error {
+	config, err := c.Minio.GetBucketLifecycle(ctx, meta.BucketName)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code != "NoSuchLifecycleConfiguration" {
+			return err
+		}
+
+		config = lifecycle.NewConfiguration()
+	}
+
+	id := lifecycleRuleID(meta)
+	updated := lifecycle.NewConfiguration()
+	for _, rule := range config.Rules {
+		if !strings.HasPrefix(rule.ID, id) {
+			updated.Rules = append(updated.Rules, rule)
+		}
+	}
+	updated.Rules = append(updated.Rules, rules...)
+
+	// Buckets without any rules are left untouched
+	if len(config.Rules) == 0 && len(updated.Rules) == 0 {
+		return nil
+	}
+
+	return c.Minio.SetBucketLifecycle(ctx, meta.BucketName, updated)
+}
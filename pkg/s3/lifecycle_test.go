@@ -0,0 +1,108 @@
+package s3_test
+
+import (
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lifecycle", func() {
+	It("should return no lifecycle without lifecycle parameters", func() {
+		l, err := s3.ParseLifecycle(map[string]string{"mounter": "s3fs"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l).To(BeNil())
+	})
+
+	It("should parse all lifecycle parameters", func() {
+		l, err := s3.ParseLifecycle(map[string]string{
+			s3.LifecycleExpirationDays:                     "7",
+			s3.LifecycleExpirationPath:                     "/tmp/",
+			s3.LifecycleNoncurrentVersionExpirationDays:    "30",
+			s3.LifecycleAbortIncompleteMultipartUploadDays: "1",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l).To(Equal(&s3.Lifecycle{
+			ExpirationDays:                     7,
+			ExpirationPath:                     "tmp",
+			NoncurrentVersionExpirationDays:    30,
+			AbortIncompleteMultipartUploadDays: 1,
+		}))
+	})
+
+	It("should return the parameters it has been parsed from", func() {
+		params := map[string]string{
+			s3.LifecycleExpirationDays: "7",
+			s3.LifecycleExpirationPath: "tmp",
+		}
+		l, err := s3.ParseLifecycle(params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Params()).To(Equal(params))
+	})
+
+	DescribeTable("should reject invalid parameters",
+		func(params map[string]string) {
+			_, err := s3.ParseLifecycle(params)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("unknown parameter", map[string]string{"lifecycle.unknown": "1"}),
+		Entry("days that aren't a number", map[string]string{s3.LifecycleExpirationDays: "seven"}),
+		Entry("zero days", map[string]string{s3.LifecycleExpirationDays: "0"}),
+		Entry("negative days", map[string]string{s3.LifecycleAbortIncompleteMultipartUploadDays: "-1"}),
+		Entry("path leaving the volume", map[string]string{s3.LifecycleExpirationDays: "1", s3.LifecycleExpirationPath: "../other"}),
+		Entry("path without expiration", map[string]string{s3.LifecycleExpirationPath: "tmp"}),
+	)
+
+	Describe("Validate", func() {
+		DescribeTable("should validate the lifecycle against the path of the volume",
+			func(fsPath string, l *s3.Lifecycle, valid bool) {
+				err := l.Validate(&s3.FSMeta{BucketName: "bucket", Prefix: "volume", FSPath: fsPath})
+				if valid {
+					Expect(err).NotTo(HaveOccurred())
+				} else {
+					Expect(err).To(HaveOccurred())
+				}
+			},
+			Entry("expiration of all data below the filesystem path", "csi-fs", &s3.Lifecycle{ExpirationDays: 7}, true),
+			Entry("expiration of all data next to the metadata", "", &s3.Lifecycle{ExpirationDays: 7}, false),
+			Entry("expiration of a path next to the metadata", "", &s3.Lifecycle{ExpirationDays: 7, ExpirationPath: "tmp"}, true),
+			Entry("expiration of the snapshots", "", &s3.Lifecycle{ExpirationDays: 7, ExpirationPath: ".snapshots"}, false),
+			Entry("noncurrent versions next to the metadata", "", &s3.Lifecycle{NoncurrentVersionExpirationDays: 7}, true),
+		)
+	})
+
+	Describe("Rules", func() {
+		It("should limit all rules to the data of the volume", func() {
+			meta := &s3.FSMeta{BucketName: "bucket", Prefix: "volume", FSPath: "csi-fs"}
+			rules := (&s3.Lifecycle{
+				ExpirationDays:                     7,
+				ExpirationPath:                     "tmp",
+				NoncurrentVersionExpirationDays:    30,
+				AbortIncompleteMultipartUploadDays: 1,
+			}).Rules(meta)
+
+			Expect(rules).To(HaveLen(3))
+			Expect(rules[0].ID).To(Equal("nomad-csi-s3:bucket/volume:expiration"))
+			Expect(rules[0].RuleFilter.Prefix).To(Equal("volume/csi-fs/tmp/"))
+			Expect(rules[0].Expiration.Days).To(Equal(lifecycle.ExpirationDays(7)))
+			Expect(rules[1].ID).To(Equal("nomad-csi-s3:bucket/volume:noncurrent-version-expiration"))
+			Expect(rules[1].RuleFilter.Prefix).To(Equal("volume/csi-fs/"))
+			Expect(rules[1].NoncurrentVersionExpiration.NoncurrentDays).To(Equal(lifecycle.ExpirationDays(30)))
+			Expect(rules[2].ID).To(Equal("nomad-csi-s3:bucket/volume:abort-incomplete-multipart-upload"))
+			Expect(rules[2].RuleFilter.Prefix).To(Equal("volume/csi-fs/"))
+			Expect(rules[2].AbortIncompleteMultipartUpload.DaysAfterInitiation).To(Equal(lifecycle.ExpirationDays(1)))
+		})
+
+		It("should expire the whole bucket of volumes without a prefix", func() {
+			rules := (&s3.Lifecycle{ExpirationDays: 7}).Rules(&s3.FSMeta{BucketName: "bucket"})
+			Expect(rules).To(HaveLen(1))
+			Expect(rules[0].ID).To(Equal("nomad-csi-s3:bucket:expiration"))
+			Expect(rules[0].RuleFilter.Prefix).To(BeEmpty())
+		})
+
+		It("should return no rules for an empty lifecycle", func() {
+			Expect((&s3.Lifecycle{}).Rules(&s3.FSMeta{BucketName: "bucket"})).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,112 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	RetentionGovernance = "governance"
+	RetentionCompliance = "compliance"
+)
+
+var RetentionModes = []string{RetentionGovernance, RetentionCompliance}
+
+func toRetentionMode(mode string) (minio.RetentionMode, error) {
+	switch mode {
+	case RetentionGovernance:
+		return minio.Governance, nil
+	case RetentionCompliance:
+		return minio.Compliance, nil
+	}
+
+	return "", fmt.Errorf("invalid retention mode '%s', must be one of %v", mode, RetentionModes)
+}
+
+// SetObjectLockRetention sets the default retention of the bucket, which is applied to every object written to it.
+// The bucket must have been created with object lock enabled.
+func (c *S3Client) SetObjectLockRetention(ctx context.Context, bucketName, mode string, days int) error {
+	retention, err := toRetentionMode(mode)
+	if err != nil {
+		return err
+	}
+
+	validity := uint(days)
+	unit := minio.Days
+
+	return c.Minio.SetObjectLockConfig(ctx, bucketName, &retention, &validity, &unit)
+}
+
+// HasRetainedObjects returns true if any version of an object below the prefix is still retained or under legal hold,
+// which prevents it from being removed until its retention has expired or the legal hold has been released.
+// Versions written within the default retention of the bucket are detected from the listing alone,
+// so the retention and legal hold of each version are only requested if none of them is retained by default.
+func (c *S3Client) HasRetainedObjects(ctx context.Context, bucketName, prefix string, retentionDays int) (bool, error) {
+	now := time.Now()
+
+	if retentionDays > 0 {
+		window := time.Duration(retentionDays) * 24 * time.Hour
+		retained, err := c.anyVersion(ctx, bucketName, prefix, func(object minio.ObjectInfo) (bool, error) {
+			return now.Before(object.LastModified.Add(window)), nil
+		})
+		if err != nil || retained {
+			return retained, err
+		}
+	}
+
+	// Versions may still be retained individually beyond the default retention, or be under legal hold
+	return c.anyVersion(ctx, bucketName, prefix, func(object minio.ObjectInfo) (bool, error) {
+		return c.isLocked(ctx, bucketName, object, now)
+	})
+}
+
+// anyVersion returns true if locked returns true for any version of an object below the prefix, skipping delete markers.
+func (c *S3Client) anyVersion(ctx context.Context, bucketName, prefix string, locked func(minio.ObjectInfo) (bool, error)) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range c.Minio.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:       prefix,
+		Recursive:    true,
+		WithVersions: true,
+	}) {
+		if object.Err != nil {
+			return false, object.Err
+		}
+
+		if object.IsDeleteMarker {
+			continue
+		}
+
+		if ok, err := locked(object); err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+// isLocked returns true if the version of the object is retained or under legal hold.
+func (c *S3Client) isLocked(ctx context.Context, bucketName string, object minio.ObjectInfo, now time.Time) (bool, error) {
+	_, until, err := c.Minio.GetObjectRetention(ctx, bucketName, object.Key, object.VersionID)
+	if err != nil && minio.ToErrorResponse(err).Code != "NoSuchObjectLockConfiguration" {
+		return false, err
+	}
+
+	if until != nil && until.After(now) {
+		return true, nil
+	}
+
+	hold, err := c.Minio.GetObjectLegalHold(ctx, bucketName, object.Key, minio.GetObjectLegalHoldOptions{VersionID: object.VersionID})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchObjectLockConfiguration" {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return hold != nil && *hold == minio.LegalHoldEnabled, nil
+}
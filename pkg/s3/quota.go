@@ -0,0 +1,60 @@
+package s3
+
+import (
+	"context"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+const (
+	// QuotaNone only records the capacity of a volume without enforcing it
+	QuotaNone = ""
+	// QuotaBackend enforces the capacity with a hard bucket quota of the backend
+	QuotaBackend = "backend"
+	// QuotaNode enforces the capacity by remounting the volume read-only on the nodes, once its usage exceeds the capacity
+	QuotaNode = "node"
+)
+
+var QuotaModes = []string{
+	QuotaNone,
+	QuotaBackend,
+	QuotaNode,
+}
+
+func IsValidQuota(quota string) bool {
+	for _, mode := range QuotaModes {
+		if quota == mode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CreateAdminClient returns a client for the admin API of MinIO, which is used for features not covered by the S3 API.
+func (c *S3Client) CreateAdminClient() (*madmin.AdminClient, error) {
+	endpoint, secure, err := parseEndpoint(c.Config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return madmin.New(endpoint, c.Config.AccessKeyID, c.Config.SecretAccessKey, secure)
+}
+
+// SetBucketQuota sets a hard quota for the bucket, a size of 0 removes the quota.
+func (c *S3Client) SetBucketQuota(ctx context.Context, bucketName string, size int64) error {
+	admin, err := c.CreateAdminClient()
+	if err != nil {
+		return err
+	}
+
+	quota := &madmin.BucketQuota{
+		Quota: uint64(size),
+		Size:  uint64(size),
+	}
+	if size > 0 {
+		quota.Type = madmin.HardQuota
+	}
+
+	return admin.SetBucketQuota(ctx, bucketName, quota)
+}
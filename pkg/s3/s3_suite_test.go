@@ -0,0 +1,13 @@
+package s3
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestS3(tst *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(tst, "S3")
+}
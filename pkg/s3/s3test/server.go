@@ -0,0 +1,323 @@
+// Package s3test provides a minimal in-memory S3 endpoint for tests.
+package s3test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+)
+
+const (
+	Region          = "us-east-1"
+	AccessKeyID     = "access"
+	SecretAccessKey = "secret"
+)
+
+// LastModified is reported as modification time of all objects and buckets.
+var LastModified = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Server serves the buckets and objects it has been populated with, which is limited to listing buckets,
+// listing objects and reading, writing and deleting single objects.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+	// Keys that are rejected with AccessDenied
+	denied map[string]bool
+}
+
+type listBucketsResult struct {
+	XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+	Buckets []bucket `xml:"Buckets>Bucket"`
+}
+
+type bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listObjectsResult struct {
+	XMLName        xml.Name       `xml:"ListBucketResult"`
+	Name           string         `xml:"Name"`
+	Prefix         string         `xml:"Prefix"`
+	KeyCount       int            `xml:"KeyCount"`
+	MaxKeys        int            `xml:"MaxKeys"`
+	Delimiter      string         `xml:"Delimiter"`
+	IsTruncated    bool           `xml:"IsTruncated"`
+	Contents       []object       `xml:"Contents"`
+	CommonPrefixes []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+// NewServer starts a server, which contains the empty buckets.
+func NewServer(buckets ...string) *Server {
+	s := &Server{
+		buckets: make(map[string]map[string][]byte),
+		denied:  make(map[string]bool),
+	}
+	for _, name := range buckets {
+		s.buckets[name] = make(map[string][]byte)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+// Config returns the config of a client of the server.
+func (s *Server) Config() *s3.S3Config {
+	return &s3.S3Config{
+		Endpoint:        s.URL,
+		Region:          Region,
+		AccessKeyID:     AccessKeyID,
+		SecretAccessKey: SecretAccessKey,
+	}
+}
+
+// Client returns a client of the server.
+func (s *Server) Client() *s3.S3Client {
+	client, err := s3.CreateClientFromConfig(s.Config())
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// Put creates or replaces the object key within the bucket, which is created if it doesn't exist yet.
+func (s *Server) Put(bucketName, key, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[bucketName]; !ok {
+		s.buckets[bucketName] = make(map[string][]byte)
+	}
+	s.buckets[bucketName][key] = []byte(content)
+}
+
+// Get returns the content of the object key within the bucket and whether it exists.
+func (s *Server) Get(bucketName, key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, ok := s.buckets[bucketName][key]
+	return string(content), ok
+}
+
+// Deny rejects all requests to the object key within any bucket.
+func (s *Server) Deny(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.denied[key] = true
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucketName == "" {
+		if r.Method == http.MethodGet {
+			s.listBuckets(w)
+			return
+		}
+
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented")
+		return
+	}
+
+	objects, ok := s.buckets[bucketName]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	if s.denied[key] {
+		writeError(w, r, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	if key == "" {
+		s.serveBucket(w, r, bucketName, objects)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		content, ok := objects[key]
+		if !ok {
+			writeError(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		w.Header().Set("Last-Modified", LastModified.Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(content)
+		}
+	case http.MethodPut:
+		content, err := io.ReadAll(r.Body)
+		if err == nil && strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			content, err = decodeChunks(content)
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "InternalError")
+			return
+		}
+
+		objects[key] = content
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// decodeChunks returns the payload of a streaming upload, which is sent as chunks of '<hex size>;chunk-signature=<signature>\r\n<data>\r\n'.
+// Signatures aren't verified.
+func decodeChunks(body []byte) ([]byte, error) {
+	content := make([]byte, 0, len(body))
+	for {
+		header, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		if !ok {
+			return nil, fmt.Errorf("missing chunk header")
+		}
+
+		size, err := strconv.ParseInt(string(bytes.SplitN(header, []byte(";"), 2)[0]), 16, 64)
+		if err != nil || size > int64(len(rest)) {
+			return nil, fmt.Errorf("invalid chunk header '%s'", header)
+		}
+
+		if size == 0 {
+			return content, nil
+		}
+
+		content = append(content, rest[:size]...)
+		body = bytes.TrimPrefix(rest[size:], []byte("\r\n"))
+	}
+}
+
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request, bucketName string, objects map[string][]byte) {
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && query.Has("location"):
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(struct {
+			XMLName xml.Name `xml:"LocationConstraint"`
+			Region  string   `xml:",chardata"`
+		}{Region: Region})
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		s.listObjects(w, bucketName, objects, query)
+	default:
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (s *Server) listBuckets(w http.ResponseWriter) {
+	result := listBucketsResult{}
+	for name := range s.buckets {
+		result.Buckets = append(result.Buckets, bucket{
+			Name:         name,
+			CreationDate: LastModified.Format(time.RFC3339),
+		})
+	}
+	sort.Slice(result.Buckets, func(i, j int) bool {
+		return result.Buckets[i].Name < result.Buckets[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// listObjects lists all objects at once, as the results are never truncated.
+func (s *Server) listObjects(w http.ResponseWriter, bucketName string, objects map[string][]byte, query url.Values) {
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+
+	result := listObjectsResult{
+		Name:      bucketName,
+		Prefix:    prefix,
+		MaxKeys:   1000,
+		Delimiter: delimiter,
+	}
+
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	found := make(map[string]bool)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common := key[:len(prefix)+i+len(delimiter)]
+				if !found[common] {
+					found[common] = true
+					result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: common})
+				}
+				continue
+			}
+		}
+
+		result.Contents = append(result.Contents, object{
+			Key:          key,
+			LastModified: LastModified.Format(time.RFC3339),
+			ETag:         `"etag"`,
+			Size:         len(objects[key]),
+		})
+	}
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	// Responses to HEAD requests have no body, so the client derives the code from the status
+	if r.Method != http.MethodHead {
+		xml.NewEncoder(w).Encode(errorResponse{Code: code, Message: code})
+	}
+}
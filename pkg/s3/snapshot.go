@@ -0,0 +1,220 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	// Snapshots are stored below the prefix of their volume, next to its metadata
+	SnapshotsPath       = ".snapshots"
+	SnapshotMetaPrefix  = ".snapshot-"
+	SnapshotMetaSuffix  = ".json"
+	SnapshotIDSeparator = "@"
+)
+
+type SnapshotMeta struct {
+	SnapshotID     string    `json:"id"`
+	Name           string    `json:"name"`
+	SourceVolumeID string    `json:"sourcevolumeid"`
+	BucketName     string    `json:"bucket"`
+	Prefix         string    `json:"prefix"`
+	SizeBytes      int64     `json:"sizebytes"`
+	CreationTime   time.Time `json:"creationtime"`
+}
+
+// SnapshotID returns the id of a snapshot, which contains the id of its source volume.
+func SnapshotID(volumeID, name string) string {
+	return volumeID + SnapshotIDSeparator + name
+}
+
+// SnapshotIDToVolumeName splits a snapshot id into the id of its source volume and the name of the snapshot.
+func SnapshotIDToVolumeName(snapshotID string) (string, string, error) {
+	i := strings.LastIndex(snapshotID, SnapshotIDSeparator)
+	if i <= 0 || i >= len(snapshotID)-1 {
+		return "", "", fmt.Errorf("invalid snapshot id '%s'", snapshotID)
+	}
+
+	return snapshotID[:i], snapshotID[i+1:], nil
+}
+
+// SnapshotDataPath returns the path the data of a snapshot is copied to.
+func SnapshotDataPath(prefix, name string) string {
+	return path.Join(prefix, SnapshotsPath, name)
+}
+
+func snapshotMetaName(prefix, name string) string {
+	return path.Join(prefix, SnapshotMetaPrefix+name+SnapshotMetaSuffix)
+}
+
+func isSnapshotMeta(key string) bool {
+	base := path.Base(key)
+	return strings.HasPrefix(base, SnapshotMetaPrefix) && strings.HasSuffix(base, SnapshotMetaSuffix)
+}
+
+// CopyObjects copies all objects below srcPrefix to dstPrefix with server-side copies, skipping all keys with an excluded prefix.
+// It returns the total size of all copied objects.
+func (c *S3Client) CopyObjects(ctx context.Context, srcBucket, srcPrefix, dstBucket, dstPrefix string, exclude ...string) (int64, error) {
+	if len(srcPrefix) > 0 && !strings.HasSuffix(srcPrefix, "/") {
+		srcPrefix += "/"
+	}
+
+	var size int64
+	for object := range c.Minio.ListObjects(ctx, srcBucket, minio.ListObjectsOptions{
+		Prefix:    srcPrefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return 0, object.Err
+		}
+
+		if isExcluded(object.Key, exclude) {
+			continue
+		}
+
+		dst := path.Join(dstPrefix, strings.TrimPrefix(object.Key, srcPrefix))
+		// Keeps the trailing slash of directory markers
+		if strings.HasSuffix(object.Key, "/") {
+			dst += "/"
+		}
+
+		if err := c.copyObject(ctx, srcBucket, object.Key, dstBucket, dst); err != nil {
+			return 0, fmt.Errorf("failed to copy object %s: %w", object.Key, err)
+		}
+
+		size += object.Size
+	}
+
+	return size, nil
+}
+
+func (c *S3Client) copyObject(ctx context.Context, srcBucket, src, dstBucket, dst string) error {
+	// ComposeObject falls back to multipart copies for objects larger than 5GiB
+	_, err := c.Minio.ComposeObject(ctx, minio.CopyDestOptions{
+		Bucket: dstBucket,
+		Object: dst,
+	}, minio.CopySrcOptions{
+		Bucket: srcBucket,
+		Object: src,
+	})
+
+	return err
+}
+
+func isExcluded(key string, exclude []string) bool {
+	for _, prefix := range exclude {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *S3Client) SetSnapshotMeta(ctx context.Context, meta *SnapshotMeta) error {
+	b := new(bytes.Buffer)
+	json.NewEncoder(b).Encode(meta)
+	opts := minio.PutObjectOptions{ContentType: "application/json"}
+	_, err := c.Minio.PutObject(ctx, meta.BucketName, snapshotMetaName(meta.Prefix, meta.Name), b, int64(b.Len()), opts)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IsValidSnapshotName returns true if the name can't address objects outside of the snapshots of a volume.
+func IsValidSnapshotName(name string) bool {
+	return len(name) > 0 && !strings.Contains(name, "/") && !strings.Contains(name, "..")
+}
+
+// GetSnapshotMeta returns the snapshot of the volume at prefix. The metadata determines the objects removed along with
+// the snapshot, so metadata that doesn't belong to the snapshot is rejected, as it could have been written by the tasks using the volume.
+func (c *S3Client) GetSnapshotMeta(ctx context.Context, bucketName, prefix, name string) (*SnapshotMeta, error) {
+	if !IsValidSnapshotName(name) {
+		return nil, fmt.Errorf("invalid snapshot name '%s'", name)
+	}
+
+	key := snapshotMetaName(prefix, name)
+	meta, err := c.getSnapshotMeta(ctx, bucketName, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.BucketName != bucketName || meta.Prefix != prefix || snapshotMetaName(meta.Prefix, meta.Name) != key {
+		return nil, fmt.Errorf("metadata %s/%s doesn't belong to snapshot %s", bucketName, key, name)
+	}
+
+	return meta, nil
+}
+
+func (c *S3Client) getSnapshotMeta(ctx context.Context, bucketName, key string) (*SnapshotMeta, error) {
+	obj, err := c.Minio.GetObject(ctx, bucketName, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	b, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta SnapshotMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil, err
+	}
+
+	return &meta, nil
+}
+
+// ListSnapshotMetas returns all snapshots of the volume at prefix, or of all volumes within the bucket if recursive is set.
+func (c *S3Client) ListSnapshotMetas(ctx context.Context, bucketName, prefix string, recursive bool) ([]*SnapshotMeta, error) {
+	listPrefix := ""
+	if len(prefix) > 0 {
+		listPrefix = prefix + "/"
+	}
+
+	metas := make([]*SnapshotMeta, 0)
+	for object := range c.Minio.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:    listPrefix,
+		Recursive: recursive,
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+
+		if !isSnapshotMeta(object.Key) || strings.Contains(object.Key, SnapshotsPath+"/") {
+			continue
+		}
+
+		// Files within a volume may use the same naming, so only valid snapshots are returned
+		meta, err := c.getSnapshotMeta(ctx, bucketName, object.Key)
+		if err != nil || meta.BucketName != bucketName || snapshotMetaName(meta.Prefix, meta.Name) != object.Key {
+			log.Printf("Ignoring invalid snapshot %s/%s", bucketName, object.Key)
+			continue
+		}
+
+		metas = append(metas, meta)
+	}
+
+	return metas, nil
+}
+
+// RemoveSnapshot removes the data of a snapshot, followed by its metadata.
+func (c *S3Client) RemoveSnapshot(ctx context.Context, meta *SnapshotMeta) error {
+	if err := c.RemoveObjects(ctx, meta.BucketName, SnapshotDataPath(meta.Prefix, meta.Name)+"/"); err != nil {
+		return err
+	}
+
+	return c.Minio.RemoveObject(ctx, meta.BucketName, snapshotMetaName(meta.Prefix, meta.Name), minio.RemoveObjectOptions{})
+}
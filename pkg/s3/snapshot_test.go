@@ -0,0 +1,77 @@
+package s3_test
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3/s3test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot", func() {
+	DescribeTable("IsValidSnapshotName",
+		func(name string, valid bool) {
+			Expect(s3.IsValidSnapshotName(name)).To(Equal(valid))
+		},
+		Entry("plain name", "snap-1", true),
+		Entry("dots within the name", "snap.1", true),
+		Entry("empty name", "", false),
+		Entry("slash", "other/snap", false),
+		Entry("parent directory", "..", false),
+		Entry("parent directory within the name", "snap..1", false),
+	)
+
+	Describe("GetSnapshotMeta", func() {
+		var (
+			ctx    context.Context
+			server *s3test.Server
+			client *s3.S3Client
+		)
+
+		putSnapshot := func(key string, meta *s3.SnapshotMeta) {
+			b, err := json.Marshal(meta)
+			Expect(err).NotTo(HaveOccurred())
+
+			server.Put("bucket", key, string(b))
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			server = s3test.NewServer("bucket")
+			client = server.Client()
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should return the snapshot", func() {
+			putSnapshot("vol/.snapshot-snap.json", &s3.SnapshotMeta{Name: "snap", BucketName: "bucket", Prefix: "vol"})
+
+			meta, err := client.GetSnapshotMeta(ctx, "bucket", "vol", "snap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(meta.Name).To(Equal("snap"))
+		})
+
+		DescribeTable("should reject metadata of other snapshots",
+			func(meta *s3.SnapshotMeta) {
+				putSnapshot("vol/.snapshot-snap.json", meta)
+
+				_, err := client.GetSnapshotMeta(ctx, "bucket", "vol", "snap")
+				Expect(err).To(HaveOccurred())
+			},
+			Entry("other bucket", &s3.SnapshotMeta{Name: "snap", BucketName: "other", Prefix: "vol"}),
+			Entry("other prefix", &s3.SnapshotMeta{Name: "snap", BucketName: "bucket", Prefix: "other"}),
+			Entry("other name", &s3.SnapshotMeta{Name: "other", BucketName: "bucket", Prefix: "vol"}),
+			Entry("name outside of the volume", &s3.SnapshotMeta{Name: "../../data", BucketName: "bucket", Prefix: "vol"}),
+		)
+
+		It("should reject invalid names", func() {
+			_, err := client.GetSnapshotMeta(ctx, "bucket", "vol", "../snap")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,60 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/minio/minio-go/v7/pkg/tags"
+)
+
+const (
+	// All tags of a volume are defined as parameters with this prefix
+	TagParamPrefix = "tag."
+)
+
+// ParseTags returns the tags defined by the volume parameters, or nil if no tags are defined.
+// Tags are validated against the limits of object tags, as they are also applied to the metadata of the volume.
+func ParseTags(params map[string]string) (map[string]string, error) {
+	var t map[string]string
+	for key, value := range params {
+		if !strings.HasPrefix(key, TagParamPrefix) {
+			continue
+		}
+
+		if t == nil {
+			t = make(map[string]string)
+		}
+		t[strings.TrimPrefix(key, TagParamPrefix)] = value
+	}
+
+	if t == nil {
+		return nil, nil
+	}
+
+	if _, err := tags.MapToObjectTags(t); err != nil {
+		return nil, fmt.Errorf("invalid tags: %w", err)
+	}
+
+	return t, nil
+}
+
+// TagParams returns the tags of the volume as volume parameters.
+func TagParams(t map[string]string) map[string]string {
+	params := make(map[string]string, len(t))
+	for key, value := range t {
+		params[TagParamPrefix+key] = value
+	}
+
+	return params
+}
+
+// SetBucketTags replaces all tags of the bucket.
+func (c *S3Client) SetBucketTags(ctx context.Context, bucketName string, t map[string]string) error {
+	bucketTags, err := tags.MapToBucketTags(t)
+	if err != nil {
+		return err
+	}
+
+	return c.Minio.SetBucketTagging(ctx, bucketName, bucketTags)
+}
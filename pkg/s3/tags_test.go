@@ -0,0 +1,61 @@
+package s3_test
+
+import (
+	"strings"
+
+	"github.com/mwantia/nomad-csi-s3-plugin/pkg/s3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tags", func() {
+	It("should return no tags without tag parameters", func() {
+		t, err := s3.ParseTags(map[string]string{"mounter": "s3fs"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t).To(BeNil())
+	})
+
+	It("should only parse parameters with the tag prefix", func() {
+		t, err := s3.ParseTags(map[string]string{
+			"mounter":         "s3fs",
+			"tag.team":        "payments",
+			"tag.cost-center": "cc-4711",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t).To(Equal(map[string]string{
+			"team":        "payments",
+			"cost-center": "cc-4711",
+		}))
+	})
+
+	It("should reject more tags than supported by objects", func() {
+		params := make(map[string]string)
+		for _, key := range strings.Split("a,b,c,d,e,f,g,h,i,j,k", ",") {
+			params[s3.TagParamPrefix+key] = "value"
+		}
+
+		_, err := s3.ParseTags(params)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject invalid tags", func() {
+		_, err := s3.ParseTags(map[string]string{
+			"tag.team": strings.Repeat("x", 257),
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should return the parameters it has been parsed from", func() {
+		params := map[string]string{
+			"tag.team":        "payments",
+			"tag.cost-center": "cc-4711",
+		}
+		t, err := s3.ParseTags(params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s3.TagParams(t)).To(Equal(params))
+	})
+
+	It("should return no parameters without tags", func() {
+		Expect(s3.TagParams(nil)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,45 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	VersioningEnabled   = "enabled"
+	VersioningSuspended = "suspended"
+)
+
+// SetBucketVersioning enables or suspends the versioning of the bucket.
+func (c *S3Client) SetBucketVersioning(ctx context.Context, bucketName, versioning string) error {
+	switch versioning {
+	case VersioningEnabled:
+		return c.Minio.EnableVersioning(ctx, bucketName)
+	case VersioningSuspended:
+		return c.Minio.SuspendVersioning(ctx, bucketName)
+	}
+
+	return fmt.Errorf("invalid versioning '%s', must be one of [%s %s]", versioning, VersioningEnabled, VersioningSuspended)
+}
+
+// IsVersioned returns true if versioning has ever been enabled for the bucket, in which case objects can have multiple versions.
+// Backends without support for versioning are treated as unversioned.
+func (c *S3Client) IsVersioned(ctx context.Context, bucketName string) bool {
+	config, err := c.Minio.GetBucketVersioning(ctx, bucketName)
+	if err != nil {
+		return false
+	}
+
+	return config.Enabled() || config.Suspended()
+}
+
+// listObjectsOptions returns the options to list all objects below the prefix, including all versions and delete markers if the bucket is versioned.
+func (c *S3Client) listObjectsOptions(ctx context.Context, bucketName, prefix string) minio.ListObjectsOptions {
+	return minio.ListObjectsOptions{
+		Prefix:       prefix,
+		Recursive:    true,
+		WithVersions: c.IsVersioned(ctx, bucketName),
+	}
+}